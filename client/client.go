@@ -0,0 +1,423 @@
+// Package client is a Go SDK for the authentication service's HTTP API. It keeps the token
+// pair of the logged in session, sends the access token as a bearer token and refreshes the
+// pair shortly before the access token expires or when a request is rejected with 401.
+//
+// A Client is safe for concurrent use. Refreshes are serialized so a rotated refresh token is
+// never presented twice, which the service would treat as token theft and answer by signing
+// the whole session out.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrNotLoggedIn is returned by calls that need a session when the client holds no tokens.
+var ErrNotLoggedIn = errors.New("client: not logged in")
+
+// Config configures a Client.
+type Config struct {
+	// BaseURL is where the service is served, e.g. https://auth.example.com.
+	BaseURL string
+	// HTTPClient sends the requests. Defaults to a client with a 30 second timeout.
+	HTTPClient *http.Client
+	// RefreshBefore is how long before the access token expires it is refreshed. Defaults to 1 minute.
+	RefreshBefore time.Duration
+	// OnTokens, when set, is called with every new token pair so it can be persisted.
+	OnTokens func(TokenPair)
+}
+
+// Client calls the API on behalf of one login session.
+type Client struct {
+	config Config
+
+	mu        sync.Mutex
+	tokens    TokenPair
+	expiresAt time.Time
+
+	// refreshMu serializes refreshes so concurrent 401s only rotate the pair once
+	refreshMu sync.Mutex
+}
+
+// New returns a client for the service at config.BaseURL.
+func New(config Config) (*Client, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("client: BaseURL is required")
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = time.Minute
+	}
+	return &Client{config: config}, nil
+}
+
+// Tokens returns the current token pair.
+func (c *Client) Tokens() TokenPair {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens
+}
+
+// SetTokens resumes a session from a previously stored token pair.
+func (c *Client) SetTokens(tokens TokenPair) {
+	c.mu.Lock()
+	c.tokens = tokens
+	c.expiresAt = expiry(tokens.Token)
+	c.mu.Unlock()
+
+	if c.config.OnTokens != nil {
+		c.config.OnTokens(tokens)
+	}
+}
+
+// Signup creates an account and returns its id. It does not log in.
+func (c *Client) Signup(ctx context.Context, request SignupRequest) (string, error) {
+	var response struct {
+		InsertedID string `json:"InsertedID"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/users/signup", request, &response, false); err != nil {
+		return "", err
+	}
+	return response.InsertedID, nil
+}
+
+// Login signs in with email and password and keeps the issued token pair.
+func (c *Client) Login(ctx context.Context, email string, password string) (*User, error) {
+	request := map[string]string{"email": email, "Password": password}
+	var user User
+	if err := c.do(ctx, http.MethodPost, "/users/login", request, &user, false); err != nil {
+		return nil, err
+	}
+
+	c.SetTokens(TokenPair{Token: user.Token, RefreshToken: user.RefreshToken})
+	return &user, nil
+}
+
+// VerifyLogin completes a login that had to be confirmed, with the challenge token of the
+// APIError Login returned and a code sent by method: "email" or "totp". It keeps the issued
+// token pair like Login.
+func (c *Client) VerifyLogin(ctx context.Context, challengeToken string, method string, code string) (*User, error) {
+	request := map[string]string{"challenge_token": challengeToken, "method": method, "code": code}
+	var user User
+	if err := c.do(ctx, http.MethodPost, "/users/login/verify", request, &user, false); err != nil {
+		return nil, err
+	}
+
+	c.SetTokens(TokenPair{Token: user.Token, RefreshToken: user.RefreshToken})
+	return &user, nil
+}
+
+// Reauthenticate proves the user's identity again with method "password" and their
+// password, or "totp" and a code from their authenticator app, for calls that need a
+// recent sign-in. It keeps the token pair issued for the session.
+func (c *Client) Reauthenticate(ctx context.Context, method string, secret string) error {
+	request := map[string]string{"method": method, "password": secret}
+	if method == "totp" {
+		request = map[string]string{"method": method, "code": secret}
+	}
+	var tokens TokenPair
+	if err := c.do(ctx, http.MethodPost, "/users/me/reauthenticate", request, &tokens, true); err != nil {
+		return err
+	}
+	c.SetTokens(tokens)
+	return nil
+}
+
+// Refresh exchanges the refresh token for a new pair right away.
+func (c *Client) Refresh(ctx context.Context) error {
+	_, err := c.refresh(ctx, c.Tokens().Token)
+	return err
+}
+
+// Logout signs out the session on the server and forgets the tokens.
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.do(ctx, http.MethodPost, "/users/logout", nil, nil, true); err != nil {
+		return err
+	}
+	c.SetTokens(TokenPair{})
+	return nil
+}
+
+// ChangePassword replaces the password of the signed in user. Their other sessions are
+// signed out; this client stays signed in. The request needs a recent sign-in; see
+// Reauthenticate.
+func (c *Client) ChangePassword(ctx context.Context, currentPassword string, newPassword string) error {
+	request := map[string]string{"current_password": currentPassword, "new_password": newPassword}
+	return c.do(ctx, http.MethodPut, "/users/me/password", request, nil, true)
+}
+
+// ForgotPassword asks for a password reset link to be emailed to email. It succeeds whether
+// or not the address has an account.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/users/password/forgot", map[string]string{"email": email}, nil, false)
+}
+
+// ResetPassword sets a new password with the token from a reset link.
+func (c *Client) ResetPassword(ctx context.Context, token string, password string) error {
+	return c.do(ctx, http.MethodPost, "/users/password/reset", map[string]string{"token": token, "password": password}, nil, false)
+}
+
+// ChangeExpiredPassword sets a new password with the change token of the APIError Login
+// returned for an expired password. Log in again with the new password afterwards.
+func (c *Client) ChangeExpiredPassword(ctx context.Context, changeToken string, newPassword string) error {
+	request := map[string]string{"change_token": changeToken, "new_password": newPassword}
+	return c.do(ctx, http.MethodPost, "/users/password/expired", request, nil, false)
+}
+
+// ChangeEmail asks for the signed in user's email address to become email. It only changes
+// once the link sent to the new address is used, which signs every session out, this
+// client's included. The request needs a recent sign-in; see Reauthenticate.
+func (c *Client) ChangeEmail(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/users/me/email", map[string]string{"email": email}, nil, true)
+}
+
+// ConfirmEmailChange makes an email change with the token from the confirmation link.
+func (c *Client) ConfirmEmailChange(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodPost, "/users/email/confirm", map[string]string{"token": token}, nil, false)
+}
+
+// UndoEmailChange cancels an email change, or reverts it once made, with the token from the
+// link sent to the old address.
+func (c *Client) UndoEmailChange(ctx context.Context, token string) error {
+	return c.do(ctx, http.MethodPost, "/users/email/undo", map[string]string{"token": token}, nil, false)
+}
+
+// GetUser returns a single user. USER accounts may only read themselves.
+func (c *Client) GetUser(ctx context.Context, userID string) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodGet, "/users/"+url.PathEscape(userID), nil, &user, true); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetRole promotes a user to ADMIN or demotes them to USER. It needs an ADMIN session.
+func (c *Client) SetRole(ctx context.Context, userID string, role string) (*User, error) {
+	request := map[string]string{"user_type": role}
+	var user User
+	if err := c.do(ctx, http.MethodPatch, "/users/"+url.PathEscape(userID)+"/role", request, &user, true); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SuspendUser suspends a user, signing them out everywhere. It needs an ADMIN session.
+func (c *Client) SuspendUser(ctx context.Context, userID string, reason string) (*User, error) {
+	return c.setStatus(ctx, http.MethodPost, "/users/"+url.PathEscape(userID)+"/suspend", reason)
+}
+
+// ReactivateUser reactivates a suspended, pending or soft-deleted user. It needs an ADMIN session.
+func (c *Client) ReactivateUser(ctx context.Context, userID string, reason string) (*User, error) {
+	return c.setStatus(ctx, http.MethodPost, "/users/"+url.PathEscape(userID)+"/reactivate", reason)
+}
+
+// DeleteUser soft-deletes a user. It needs an ADMIN session.
+func (c *Client) DeleteUser(ctx context.Context, userID string, reason string) (*User, error) {
+	return c.setStatus(ctx, http.MethodDelete, "/users/"+url.PathEscape(userID), reason)
+}
+
+func (c *Client) setStatus(ctx context.Context, method string, path string, reason string) (*User, error) {
+	request := map[string]string{"reason": reason}
+	var user User
+	if err := c.do(ctx, method, path, request, &user, true); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Impersonate returns a short-lived token to act as a USER. It needs an ADMIN session and
+// does not change the tokens this client holds; use a separate Client with SetTokens to
+// make calls as the user.
+func (c *Client) Impersonate(ctx context.Context, userID string, reason string) (*Impersonation, error) {
+	request := map[string]string{"reason": reason}
+	var impersonation Impersonation
+	if err := c.do(ctx, http.MethodPost, "/users/"+url.PathEscape(userID)+"/impersonate", request, &impersonation, true); err != nil {
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+// ListUsers returns one page of users. It needs an ADMIN session.
+// Zero values for page and recordPerPage use the server defaults.
+func (c *Client) ListUsers(ctx context.Context, page int, recordPerPage int) (*UserPage, error) {
+	query := url.Values{}
+	if page > 0 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if recordPerPage > 0 {
+		query.Set("recordPerPage", strconv.Itoa(recordPerPage))
+	}
+	path := "/users"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var result UserPage
+	if err := c.do(ctx, http.MethodGet, path, nil, &result, true); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// accessToken returns a usable access token, refreshing it first when it is about to expire.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	tokens, expiresAt := c.tokens, c.expiresAt
+	c.mu.Unlock()
+
+	if tokens.Token == "" {
+		return "", ErrNotLoggedIn
+	}
+	if tokens.RefreshToken != "" && !expiresAt.IsZero() && time.Until(expiresAt) < c.config.RefreshBefore {
+		return c.refresh(ctx, tokens.Token)
+	}
+	return tokens.Token, nil
+}
+
+// refresh rotates the token pair unless another goroutine already replaced stale,
+// in which case the newer access token is returned as is.
+func (c *Client) refresh(ctx context.Context, stale string) (string, error) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	current := c.Tokens()
+	if current.Token != stale && current.Token != "" {
+		return current.Token, nil
+	}
+	if current.RefreshToken == "" {
+		return "", ErrNotLoggedIn
+	}
+
+	var tokens TokenPair
+	request := map[string]string{"refresh_token": current.RefreshToken}
+	if err := c.do(ctx, http.MethodPost, "/users/refresh", request, &tokens, false); err != nil {
+		// A rejected refresh token can't be retried; the session is over
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+			c.SetTokens(TokenPair{})
+		}
+		return "", err
+	}
+
+	c.SetTokens(tokens)
+	return tokens.Token, nil
+}
+
+// do sends a JSON request and decodes the JSON response into out. Authenticated requests
+// that come back with 401 are retried once after a refresh.
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}, authenticated bool) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	token := ""
+	if authenticated {
+		var err error
+		if token, err = c.accessToken(ctx); err != nil {
+			return err
+		}
+	}
+
+	status, header, data, err := c.send(ctx, method, path, payload, token)
+	if err != nil {
+		return err
+	}
+	// A refresh can't help when the server wants the user to sign in again
+	reauthenticate := strings.Contains(header.Get("WWW-Authenticate"), "insufficient_user_authentication")
+	if status == http.StatusUnauthorized && authenticated && !reauthenticate && c.Tokens().RefreshToken != "" {
+		if token, err = c.refresh(ctx, token); err != nil {
+			return err
+		}
+		if status, header, data, err = c.send(ctx, method, path, payload, token); err != nil {
+			return err
+		}
+	}
+
+	if status < 200 || status > 299 {
+		var response struct {
+			Error                     string   `json:"error"`
+			Change_token              string   `json:"change_token"`
+			Challenge_token           string   `json:"challenge_token"`
+			Methods                   []string `json:"methods"`
+			Reauthentication_required bool     `json:"reauthentication_required"`
+		}
+		json.Unmarshal(data, &response)
+		if response.Error == "" {
+			response.Error = http.StatusText(status)
+		}
+		apiErr := &APIError{
+			StatusCode:       status,
+			Message:          response.Error,
+			ChangeToken:      response.Change_token,
+			ChallengeToken:   response.Challenge_token,
+			ChallengeMethods: response.Methods,
+			Reauthenticate:   response.Reauthentication_required,
+		}
+		if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, payload []byte, token string) (int, http.Header, []byte, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.config.BaseURL+path, body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, resp.Header, data, err
+}
+
+// expiry reads the exp claim of a token without verifying it; the client only uses it to
+// schedule refreshes, the server still checks every token.
+func expiry(token string) time.Time {
+	if token == "" {
+		return time.Time{}
+	}
+	claims := &jwt.StandardClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil || claims.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.ExpiresAt, 0)
+}
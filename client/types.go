@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// User is a user as returned by the API. Token and RefreshToken are only set on login.
+type User struct {
+	ID           string    `json:"ID"`
+	UserID       string    `json:"user_id"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	Phone        string    `json:"phone"`
+	UserType     string    `json:"user_type"`
+	Status       string    `json:"status"`
+	StatusReason string    `json:"status_reason,omitempty"`
+	Token        string    `json:"token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UserPage is one page of the user listing.
+type UserPage struct {
+	TotalCount int64  `json:"total_count"`
+	Users      []User `json:"user_items"`
+}
+
+// SignupRequest holds the details of a new account.
+type SignupRequest struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	Password  string `json:"Password"`
+	Phone     string `json:"phone"`
+	UserType  string `json:"user_type,omitempty"`
+}
+
+// TokenPair is the access and refresh token of a login session.
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Impersonation is a short-lived token that lets an ADMIN act as another user.
+type Impersonation struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SessionID string    `json:"session_id"`
+}
+
+// APIError is returned for any response outside the 2xx range. RetryAfter is set when the
+// server rate limited the request and said when to try again. ChangeToken is set when a
+// login was refused because the password expired; pass it to ChangeExpiredPassword.
+// ChallengeToken is set when a login has to be confirmed with one of ChallengeMethods;
+// pass it to VerifyLogin. Reauthenticate is set when the call needs a recent sign-in;
+// call Client.Reauthenticate and retry.
+type APIError struct {
+	StatusCode       int
+	Message          string
+	RetryAfter       time.Duration
+	ChangeToken      string
+	ChallengeToken   string
+	ChallengeMethods []string
+	Reauthenticate   bool
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("client: %d %s", e.StatusCode, e.Message)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+)
+
+func rotateKeys(args []string) error {
+	flags, output := newFlagSet("rotate-keys")
+	flags.Parse(args)
+
+	key, err := helper.RotateSigningKey()
+	if err != nil {
+		return err
+	}
+	// Running servers pick the new key up on their next reload, within a minute. Export the
+	// keys again so audit-verify trusts the checkpoints the new key signs
+	return printResult(*output, key, []string{"KID", "ALGORITHM", "CREATED AT"},
+		[][]string{{key.Kid, key.Algorithm, key.Created_at.Format(time.RFC3339)}})
+}
+
+func exportKeys(args []string) error {
+	flags, output := newFlagSet("keys-export")
+	flags.Parse(args)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	keys, err := helper.ExportSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+	rows := [][]string{}
+	for _, key := range keys {
+		rows = append(rows, []string{key.Kid, key.Alg})
+	}
+	// Store the JSON output somewhere the database can't change, and pass it to audit-verify -keys
+	return printResult(*output, map[string][]helper.JSONWebKey{"keys": keys}, []string{"KID", "ALGORITHM"}, rows)
+}
+
+func migrate(args []string) error {
+	flags, output := newFlagSet("migrate")
+	dryRun := flags.Bool("dry-run", false, "only list the pending migrations")
+	flags.Parse(args)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	header := []string{"ID", "DESCRIPTION", "STATUS"}
+	if *dryRun {
+		pending, err := database.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		ids, rows := []string{}, [][]string{}
+		for _, migration := range pending {
+			ids = append(ids, migration.Id)
+			rows = append(rows, []string{migration.Id, migration.Description, "pending"})
+		}
+		return printResult(*output, map[string][]string{"pending": ids}, header, rows)
+	}
+
+	applied, err := database.Migrate(ctx)
+	descriptions := map[string]string{}
+	for _, migration := range database.Migrations {
+		descriptions[migration.Id] = migration.Description
+	}
+	rows := [][]string{}
+	for _, id := range applied {
+		rows = append(rows, []string{id, descriptions[id], "applied"})
+	}
+	if printErr := printResult(*output, map[string][]string{"applied": applied}, header, rows); printErr != nil {
+		return printErr
+	}
+	return err
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+)
+
+// readPassword returns the -password flag or, when it is empty, the first line of stdin
+// so passwords don't have to end up in the shell history.
+func readPassword(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no password given")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func userRow(user models.User) []string {
+	locked := ""
+	if user.Locked_at != nil {
+		locked = user.Locked_at.Format(time.RFC3339)
+	} else if user.Lockout_until != nil && time.Now().Before(*user.Lockout_until) {
+		locked = "until " + user.Lockout_until.Format(time.RFC3339)
+	}
+	return []string{user.User_id, *user.Email, *user.First_name + " " + *user.Last_name, *user.User_type, user.CurrentStatus(), locked, user.Created_at.Format(time.RFC3339)}
+}
+
+var userHeader = []string{"USER ID", "EMAIL", "NAME", "TYPE", "STATUS", "LOCKED AT", "CREATED AT"}
+
+func createAdmin(args []string) error {
+	flags, output := newFlagSet("create-admin")
+	email := flags.String("email", "", "email address (required)")
+	firstName := flags.String("first-name", "", "first name (required)")
+	lastName := flags.String("last-name", "", "last name (required)")
+	phone := flags.String("phone", "", "phone number (required)")
+	password := flags.String("password", "", "password; read from stdin when empty")
+	flags.Parse(args)
+
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	user, err := service.CreateAdmin(ctx, models.User{
+		Email:      email,
+		First_name: firstName,
+		Last_name:  lastName,
+		Phone:      phone,
+		Password:   &pass,
+	})
+	if err != nil {
+		return err
+	}
+	return printResult(*output, user, userHeader, [][]string{userRow(user)})
+}
+
+func resetPassword(args []string) error {
+	flags, output := newFlagSet("reset-password")
+	password := flags.String("password", "", "new password; read from stdin when empty")
+	flags.Parse(args)
+	ref, err := requireArg(flags, "email or user id")
+	if err != nil {
+		return err
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	user, err := service.FindUser(ctx, ref)
+	if err != nil {
+		return err
+	}
+	pass, err := readPassword(*password)
+	if err != nil {
+		return err
+	}
+	if err := service.ResetPassword(ctx, user.User_id, pass); err != nil {
+		return err
+	}
+	return printResult(*output, map[string]string{"user_id": user.User_id, "result": "password reset"},
+		[]string{"USER ID", "RESULT"}, [][]string{{user.User_id, "password reset"}})
+}
+
+func lockUser(args []string) error {
+	return setLocked("lock", args, service.LockUser)
+}
+
+func unlockUser(args []string) error {
+	return setLocked("unlock", args, service.UnlockUser)
+}
+
+func setLocked(name string, args []string, action func(context.Context, string) error) error {
+	flags, output := newFlagSet(name)
+	flags.Parse(args)
+	ref, err := requireArg(flags, "email or user id")
+	if err != nil {
+		return err
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	user, err := service.FindUser(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if err := action(ctx, user.User_id); err != nil {
+		return err
+	}
+	if user, err = service.FindUser(ctx, user.User_id); err != nil {
+		return err
+	}
+	return printResult(*output, user, userHeader, [][]string{userRow(user)})
+}
+
+func setRole(args []string) error {
+	flags, output := newFlagSet("set-role")
+	role := flags.String("role", "", "ADMIN or USER (required)")
+	flags.Parse(args)
+	ref, err := requireArg(flags, "email or user id")
+	if err != nil {
+		return err
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	user, err := service.FindUser(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if user, err = service.ChangeRole(ctx, operator{}, user.User_id, *role); err != nil {
+		return err
+	}
+	return printResult(*output, user, userHeader, [][]string{userRow(user)})
+}
+
+func revokeTokens(args []string) error {
+	flags, output := newFlagSet("revoke-tokens")
+	apiKeys := flags.Bool("api-keys", false, "also revoke the user's API keys")
+	flags.Parse(args)
+	ref, err := requireArg(flags, "email or user id")
+	if err != nil {
+		return err
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	user, err := service.FindUser(ctx, ref)
+	if err != nil {
+		return err
+	}
+	sessions, keys, err := service.RevokeTokens(ctx, user.User_id, *apiKeys)
+	if err != nil {
+		return err
+	}
+	result := map[string]interface{}{"user_id": user.User_id, "revoked_sessions": sessions, "revoked_api_keys": keys}
+	return printResult(*output, result, []string{"USER ID", "REVOKED SESSIONS", "REVOKED API KEYS"},
+		[][]string{{user.User_id, strconv.FormatInt(sessions, 10), strconv.FormatInt(keys, 10)}})
+}
+
+func listUsers(args []string) error {
+	flags, output := newFlagSet("list-users")
+	page := flags.Int("page", 1, "page number")
+	limit := flags.Int("limit", 50, "users per page")
+	flags.Parse(args)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	// authctl acts with full access, like an ADMIN on an interactive session
+	result, err := service.ListUsers(ctx, operator{}, *page, *limit)
+	if err != nil {
+		return err
+	}
+
+	rows := [][]string{}
+	for _, user := range result.User_items {
+		rows = append(rows, userRow(user))
+	}
+	return printResult(*output, result, userHeader, rows)
+}
+
+func purgeUsers(args []string) error {
+	flags, output := newFlagSet("purge-users")
+	flags.Parse(args)
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	purged, err := service.PurgeDeletedUsers(ctx)
+	if err != nil {
+		return err
+	}
+	return printResult(*output, map[string]int64{"purged": purged}, []string{"PURGED"},
+		[][]string{{strconv.FormatInt(purged, 10)}})
+}
+
+// operator is the identity authctl uses for service calls that check their caller.
+type operator struct{}
+
+func (operator) GetString(key string) string {
+	switch key {
+	case "uid":
+		return "authctl"
+	case "user_type":
+		return "ADMIN"
+	case "auth_method":
+		return "cli"
+	}
+	return ""
+}
+
+func (operator) GetStringSlice(key string) []string {
+	return nil
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var apiKeyCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "api_key")
+
+// CreateAPIKey returns a Gin handler function that creates a personal API key for the current user.
+// The plain key is returned only in this response; afterwards only its prefix is visible.
+func CreateAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// API keys can only be created from an interactive login
+		if err := helper.CheckInteractiveSession(c); err != nil {
+			helper.AbortForbidden(c, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var request struct {
+			Name          *string  `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ExpiresInDays int      `json:"expires_in_days"`
+		}
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Default to 90 days and never allow keys that live longer than a year
+		if request.ExpiresInDays == 0 {
+			request.ExpiresInDays = 90
+		}
+		if request.ExpiresInDays < 1 || request.ExpiresInDays > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must be between 1 and 365"})
+			return
+		}
+
+		if len(request.Scopes) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at least one scope is required"})
+			return
+		}
+		for _, scope := range request.Scopes {
+			if !helper.IsValidAPIKeyScope(scope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope})
+				return
+			}
+		}
+
+		key, prefix, hashedKey, err := helper.GenerateAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while generating the api key"})
+			return
+		}
+
+		var apiKey models.APIKey
+		apiKey.ID = primitive.NewObjectID()
+		apiKey.Key_id = apiKey.ID.Hex()
+		apiKey.User_id = c.GetString("uid")
+		apiKey.Name = request.Name
+		apiKey.Prefix = prefix
+		apiKey.Hashed_key = hashedKey
+		apiKey.Scopes = request.Scopes
+		apiKey.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		apiKey.Expires_at = apiKey.Created_at.Add(time.Duration(request.ExpiresInDays) * 24 * time.Hour)
+
+		if validationErr := validate.Struct(apiKey); validationErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			return
+		}
+
+		if _, insertErr := apiKeyCollection.InsertOne(ctx, apiKey); insertErr != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "api key was not created"})
+			return
+		}
+
+		recordAudit(c, helper.AuditAPIKeyCreated, apiKey.User_id, map[string]string{"key_id": apiKey.Key_id, "scopes": strings.Join(apiKey.Scopes, " ")})
+		c.JSON(http.StatusCreated, gin.H{"api_key": apiKey, "key": key})
+	}
+}
+
+// GetAPIKeys returns a Gin handler function that lists the current user's API keys, newest first.
+func GetAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckInteractiveSession(c); err != nil {
+			helper.AbortForbidden(c, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.M{"created_at": -1})
+		cursor, err := apiKeyCollection.Find(ctx, bson.M{"user_id": c.GetString("uid")}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing api keys"})
+			return
+		}
+
+		apiKeys := []models.APIKey{}
+		if err = cursor.All(ctx, &apiKeys); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing api keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, apiKeys)
+	}
+}
+
+// RevokeAPIKey returns a Gin handler function that revokes one of the current user's API keys.
+// Revoked keys are kept so they still show up in the listing.
+func RevokeAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckInteractiveSession(c); err != nil {
+			helper.AbortForbidden(c, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		revokedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		filter := bson.M{"key_id": c.Param("key_id"), "user_id": c.GetString("uid"), "revoked_at": nil}
+
+		result, err := apiKeyCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": revokedAt}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while revoking the api key"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+			return
+		}
+
+		recordAudit(c, helper.AuditAPIKeyRevoked, c.GetString("uid"), map[string]string{"key_id": c.Param("key_id")})
+		c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+	}
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+	"github.com/gin-gonic/gin"
+)
+
+// GetDevices returns a Gin handler function that lists the devices the current user has
+// signed in from, most recently used first.
+func GetDevices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		devices, err := service.ListDevices(ctx, c)
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, devices)
+	}
+}
+
+// ForgetDevice returns a Gin handler function that removes one of the current user's known
+// devices; the next login from it is treated as coming from a new device.
+func ForgetDevice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := service.ForgetDevice(ctx, c, c.Param("device_id")); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "device forgotten"})
+	}
+}
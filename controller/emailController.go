@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ChangeEmail returns a Gin handler function that starts changing the current user's email
+// address. The change is only made once the link emailed to the new address is opened.
+func ChangeEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Email string `json:"email"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+			return
+		}
+
+		if err := service.RequestEmailChange(ctx, c, request.Email); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "a confirmation link has been sent to the new email address"})
+	}
+}
+
+// ConfirmEmailChange returns a Gin handler function that makes an email change with the
+// token from the confirmation link. All of the user's sessions are signed out.
+func ConfirmEmailChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Token string `json:"token"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+			return
+		}
+
+		if err := service.ConfirmEmailChange(ctx, request.Token); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "email address changed; sign in with the new address"})
+	}
+}
+
+// UndoEmailChange returns a Gin handler function that cancels or reverts an email change
+// with the token from the link sent to the old address.
+func UndoEmailChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Token string `json:"token"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+			return
+		}
+
+		if err := service.UndoEmailChange(ctx, request.Token); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "the email change has been undone; change your password if it wasn't you"})
+	}
+}
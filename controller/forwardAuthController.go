@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// forwardAuthLoginURL is where browsers are redirected when they aren't signed in.
+// When it is empty, unauthenticated requests always get a 401.
+var forwardAuthLoginURL = helper.GetEnv("FORWARD_AUTH_LOGIN_URL", "")
+
+// forwardAuthCache keeps decisions for FORWARD_AUTH_CACHE_TTL (5s by default), which is also how
+// long a revoked token can keep working behind the proxy.
+var forwardAuthCache = helper.NewDecisionCache(helper.GetEnvDuration("FORWARD_AUTH_CACHE_TTL", 5*time.Second))
+
+type forwardAuthDecision struct {
+	claims  *helper.SignedDetails
+	authErr *middleware.AuthError
+}
+
+// forwardedRequest works out the method, host and URI of the request the proxy is asking
+// about. Traefik and Caddy send X-Forwarded-Method/Host/Uri; nginx's auth_request needs
+// X-Original-Method and X-Original-URL set in its configuration.
+func forwardedRequest(c *gin.Context) (method string, host string, uri string) {
+	method = c.GetHeader("X-Forwarded-Method")
+	if method == "" {
+		method = c.GetHeader("X-Original-Method")
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	host = c.GetHeader("X-Forwarded-Host")
+	uri = c.GetHeader("X-Forwarded-Uri")
+	if original, err := url.Parse(c.GetHeader("X-Original-URL")); err == nil && original.Host != "" {
+		host = original.Host
+		uri = original.RequestURI()
+	}
+	if host == "" {
+		host = c.Request.Host
+	}
+	if uri == "" {
+		uri = "/"
+	}
+	return method, host, uri
+}
+
+// VerifyForwardAuth returns a Gin handler function for reverse proxy forward authentication
+// (nginx auth_request, Traefik ForwardAuth, Caddy forward_auth). It authenticates the
+// original request exactly like middleware.Authenticate, applies the configured host and
+// path rules, and answers 200 with identity headers the proxy can pass upstream.
+func VerifyForwardAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method, host, uri := forwardedRequest(c)
+		path := strings.SplitN(uri, "?", 2)[0]
+
+		rule := helper.MatchForwardAuthRule(host, path)
+		if rule.Public {
+			c.Status(http.StatusOK)
+			return
+		}
+
+		// Every input that can change the outcome is part of the cache key
+		token, _ := middleware.ExtractToken(c)
+		csrfCookie, _ := c.Cookie(helper.CSRFCookieName)
+		cacheKey := helper.HashToken(strings.Join([]string{token, csrfCookie, c.GetHeader(helper.CSRFHeaderName), method, host, path}, "\x00"))
+
+		var decision forwardAuthDecision
+		if cached, found := forwardAuthCache.Get(cacheKey); found && token != "" {
+			decision = cached.(forwardAuthDecision)
+		} else {
+			decision.claims, decision.authErr = middleware.VerifyRequest(c, method)
+			if token != "" {
+				forwardAuthCache.Set(cacheKey, decision)
+			}
+		}
+
+		if decision.authErr != nil {
+			// Send browsers to the login page and let them come back afterwards
+			if decision.authErr.Status == http.StatusUnauthorized && forwardAuthLoginURL != "" && strings.Contains(c.GetHeader("Accept"), "text/html") {
+				redirect := "https://" + host + uri
+				if c.GetHeader("X-Forwarded-Proto") == "http" {
+					redirect = "http://" + host + uri
+				}
+				c.Redirect(http.StatusFound, forwardAuthLoginURL+"?rd="+url.QueryEscape(redirect))
+				return
+			}
+			decision.authErr.Abort(c)
+			return
+		}
+
+		if !rule.AllowsUserType(decision.claims.User_type) {
+			helper.AbortForbidden(c, "Unauthorized to access this resource")
+			return
+		}
+
+		c.Header("X-User-Id", decision.claims.Uid)
+		c.Header("X-User-Email", decision.claims.Email)
+		c.Header("X-User-Type", decision.claims.User_type)
+		// Tell the upstream when an ADMIN is acting as the user
+		if decision.claims.Act != nil {
+			c.Header("X-Impersonator-Id", decision.claims.Act.Sub)
+		}
+		c.Status(http.StatusOK)
+	}
+}
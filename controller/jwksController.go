@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"net/http"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS returns a Gin handler function that publishes the public signing keys as a
+// JSON Web Key Set, so other services can verify tokens without sharing a secret.
+func GetJWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := helper.PublicJWKS()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while loading the signing keys"})
+			return
+		}
+
+		// Let verifiers cache the set; they refetch on an unknown kid anyway
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, gin.H{"keys": keys})
+	}
+}
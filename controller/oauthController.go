@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// tokenTypeHints maps the typ claim to the token_type_hint values of RFC 7009.
+var tokenTypeHints = map[string]string{
+	helper.AccessToken:  "access_token",
+	helper.RefreshToken: "refresh_token",
+	helper.APIKeyToken:  "api_key",
+}
+
+// Introspect returns a Gin handler function implementing RFC 7662 token introspection.
+// It lets gateways and services that can't verify our tokens themselves ask whether a
+// token is active, including whether its session or API key has been revoked.
+func Introspect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientId, ok := helper.AuthenticateClient(c)
+		if !ok {
+			helper.AbortInvalidClient(c)
+			return
+		}
+
+		token := c.PostForm("token")
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "token is required"})
+			return
+		}
+
+		// Inactive tokens get no further detail, as the RFC requires
+		claims, msg := helper.ResolveToken(token)
+		if msg != "" {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
+
+		response := gin.H{
+			"active":     true,
+			"sub":        claims.Uid,
+			"scope":      strings.Join(claims.Scopes, " "),
+			"client_id":  clientId,
+			"token_type": tokenTypeHints[claims.Token_type],
+			"exp":        claims.ExpiresAt,
+			"iat":        claims.IssuedAt,
+			"jti":        claims.Id,
+			"sid":        claims.Session_id,
+			"email":      claims.Email,
+			"user_type":  claims.User_type,
+		}
+		// Impersonation tokens carry the acting ADMIN as in RFC 8693
+		if claims.Act != nil {
+			response["act"] = claims.Act
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// Revoke returns a Gin handler function implementing RFC 7009 token revocation.
+// Revoking an access or refresh token signs out the session it belongs to; revoking
+// an API key revokes the key. Unknown or already invalid tokens are not an error.
+func Revoke() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientId, ok := helper.AuthenticateClient(c)
+		if !ok {
+			helper.AbortInvalidClient(c)
+			return
+		}
+
+		token := c.PostForm("token")
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": "token is required"})
+			return
+		}
+
+		claims, msg := helper.ResolveToken(token)
+		if msg != "" {
+			c.Status(http.StatusOK)
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var err error
+		if claims.Token_type == helper.APIKeyToken {
+			revokedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+			_, err = apiKeyCollection.UpdateOne(ctx, bson.M{"key_id": claims.Id}, bson.M{"$set": bson.M{"revoked_at": revokedAt}})
+		} else {
+			_, err = helper.RevokeSessions(claims.Uid, bson.M{"session_id": claims.Session_id})
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "temporarily_unavailable"})
+			return
+		}
+
+		// The OAuth client is the actor here; record it alongside the revoked credential
+		recordAudit(c, helper.AuditTokenRevoked, claims.Uid, map[string]string{
+			"client_id":  clientId,
+			"token_type": tokenTypeHints[claims.Token_type],
+			"session_id": claims.Session_id,
+			"jti":        claims.Id,
+		})
+		c.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/docs"
+	"github.com/gin-gonic/gin"
+)
+
+// GetOpenAPI returns a Gin handler function that serves the OpenAPI 3 document describing
+// every HTTP endpoint, so clients can be generated from it instead of reverse-engineered.
+func GetOpenAPI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.Data(http.StatusOK, "application/json; charset=utf-8", docs.OpenAPI)
+	}
+}
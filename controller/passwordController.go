@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ChangePassword returns a Gin handler function that lets a signed in user choose a new
+// password by sending their current one along. Their other sessions are signed out.
+func ChangePassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Current_password string `json:"current_password"`
+			New_password     string `json:"new_password"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Current_password == "" || request.New_password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "current_password and new_password are required"})
+			return
+		}
+
+		if err := service.ChangePassword(ctx, c, request.Current_password, request.New_password); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "password changed"})
+	}
+}
+
+// ForgotPassword returns a Gin handler function that emails a password reset link. It
+// answers the same whether or not the email address has an account.
+func ForgotPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Email string `json:"email"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+			return
+		}
+
+		if err := service.RequestPasswordReset(ctx, request.Email); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "if the email address has an account, a reset link has been sent to it"})
+	}
+}
+
+// ResetPassword returns a Gin handler function that sets a new password with the token
+// from a reset link.
+func ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Token == "" || request.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "token and password are required"})
+			return
+		}
+
+		if err := service.ResetPasswordWithToken(ctx, request.Token, request.Password); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "password reset; sign in with the new password"})
+	}
+}
+
+// ChangeExpiredPassword returns a Gin handler function that sets a new password with the
+// change token a login with an expired password answered with.
+func ChangeExpiredPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Change_token string `json:"change_token"`
+			New_password string `json:"new_password"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Change_token == "" || request.New_password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "change_token and new_password are required"})
+			return
+		}
+
+		if err := service.ChangeExpiredPassword(ctx, request.Change_token, request.New_password); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "password changed; sign in with the new password"})
+	}
+}
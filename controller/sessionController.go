@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var sessionCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "session")
+
+// GetSessions returns a Gin handler function that lists the current user's active sessions,
+// most recently used first, flagging the one making the request.
+func GetSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckInteractiveSession(c); err != nil {
+			helper.AbortForbidden(c, err.Error())
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		filter := bson.M{
+			"user_id":    c.GetString("uid"),
+			"revoked_at": nil,
+			"expires_at": bson.M{"$gt": time.Now()},
+		}
+		opts := options.Find().SetSort(bson.M{"last_used_at": -1})
+		cursor, err := sessionCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing sessions"})
+			return
+		}
+
+		sessions := []models.Session{}
+		if err = cursor.All(ctx, &sessions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing sessions"})
+			return
+		}
+		for i := range sessions {
+			sessions[i].Current = sessions[i].Session_id == c.GetString("session_id")
+		}
+
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// RevokeSession returns a Gin handler function that signs out one of the current user's sessions.
+func RevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckInteractiveSession(c); err != nil {
+			helper.AbortForbidden(c, err.Error())
+			return
+		}
+
+		revoked, err := helper.RevokeSessions(c.GetString("uid"), bson.M{"session_id": c.Param("session_id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while signing out the session"})
+			return
+		}
+		if revoked == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+
+		recordAudit(c, helper.AuditSessionRevoked, c.GetString("uid"), map[string]string{"session_id": c.Param("session_id")})
+		c.JSON(http.StatusOK, gin.H{"message": "session signed out"})
+	}
+}
+
+// RevokeOtherSessions returns a Gin handler function that signs out every session of the
+// current user except the one making the request.
+func RevokeOtherSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckInteractiveSession(c); err != nil {
+			helper.AbortForbidden(c, err.Error())
+			return
+		}
+
+		revoked, err := helper.RevokeSessions(c.GetString("uid"), bson.M{"session_id": bson.M{"$ne": c.GetString("session_id")}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while signing out other sessions"})
+			return
+		}
+
+		recordAudit(c, helper.AuditSessionRevoked, c.GetString("uid"), map[string]string{"except_session_id": c.GetString("session_id"), "revoked": strconv.FormatInt(revoked, 10)})
+		c.JSON(http.StatusOK, gin.H{"message": "other sessions signed out", "revoked": revoked})
+	}
+}
+
+// Reauthenticate returns a Gin handler function that checks the current user's password or
+// authenticator code again, so routes that need a recent sign-in accept the session. It
+// answers with a new token pair for the session, as cookies when the client uses them.
+func Reauthenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Method   string `json:"method"`
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		c.ShouldBindJSON(&request)
+		secret := request.Password
+		if request.Method == service.StepUpTOTP {
+			secret = request.Code
+		}
+		if request.Method == "" || secret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "method and its password or code are required"})
+			return
+		}
+
+		token, refreshToken, err := service.Reauthenticate(ctx, c, request.Method, secret)
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+
+		if _, cookieErr := c.Cookie(helper.AccessTokenCookieName); cookieErr == nil || helper.IsBrowserMode(c) {
+			csrfToken, err := helper.SetAuthCookies(c, token, refreshToken)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while setting the session cookies"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"csrf_token": csrfToken})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
+	}
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+	"github.com/gin-gonic/gin"
+)
+
+// EnrollTOTP returns a Gin handler function that creates a secret for a new authenticator
+// app. It only takes effect once ConfirmTOTP gets a code from the app.
+func EnrollTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		enrollment, err := service.EnrollTOTP(ctx, c)
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+// ConfirmTOTP returns a Gin handler function that turns on the authenticator app being set
+// up once the code from it is correct.
+func ConfirmTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Code string `json:"code"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+			return
+		}
+
+		if err := service.ConfirmTOTP(ctx, c, request.Code); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "authenticator app turned on"})
+	}
+}
+
+// DisableTOTP returns a Gin handler function that removes the authenticator app of the
+// current user, given a current code from it.
+func DisableTOTP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Code string `json:"code"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+			return
+		}
+
+		if err := service.DisableTOTP(ctx, c, request.Code); err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "authenticator app removed"})
+	}
+}
@@ -2,44 +2,57 @@ package controller
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
 	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
 	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "user")
 var validate = validator.New()
 
-func HashPassword(password string) string {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	if err != nil {
-		log.Panic(err)
+// respondServiceError maps an error from the service package to an HTTP response.
+func respondServiceError(c *gin.Context, err error) {
+	var serviceErr *service.Error
+	if !errors.As(err, &serviceErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	return string(bytes)
-}
-
-func VerifyPassword(userPassword string, providedPassword string) (bool, string) {
-	err := bcrypt.CompareHashAndPassword([]byte(providedPassword), []byte(userPassword))
-	check := true
-	msg := ""
 
-	if err != nil {
-		msg = fmt.Sprintf("email of password is incorrect")
-		check = false
+	switch serviceErr.Code {
+	case service.InvalidArgument:
+		c.JSON(http.StatusBadRequest, gin.H{"error": serviceErr.Message})
+	case service.Unauthenticated:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": serviceErr.Message})
+	case service.PermissionDenied:
+		helper.AbortForbidden(c, serviceErr.Message)
+	case service.InsufficientScope:
+		helper.AbortInsufficientScope(c, serviceErr.Scope, serviceErr.Message)
+	case service.NotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": serviceErr.Message})
+	case service.AlreadyExists:
+		c.JSON(http.StatusConflict, gin.H{"error": serviceErr.Message})
+	case service.ResourceExhausted:
+		c.Header("Retry-After", strconv.FormatInt(serviceErr.RetryAfterSeconds(), 10))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": serviceErr.Message})
+	case service.StepUpRequired:
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":            serviceErr.Message,
+			"step_up_required": true,
+			"challenge_token":  serviceErr.Challenge_token,
+			"methods":          serviceErr.Challenge_methods,
+		})
+	case service.PasswordExpired:
+		c.JSON(http.StatusForbidden, gin.H{"error": serviceErr.Message, "password_expired": true, "change_token": serviceErr.Change_token})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": serviceErr.Message})
 	}
-	return check, msg
 }
 
 // Signup returns a Gin handler function for user signup.
@@ -49,69 +62,48 @@ func Signup() gin.HandlerFunc {
 		// Create a context with a timeout of 100 seconds
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel() // Ensure context cancellation at the end of the function
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		// Only the fields a new user chooses are read from the body, so the account's state,
+		// such as its status, lockout or password age, can't be set at signup
+		var request struct {
+			First_name *string `json:"first_name"`
+			Last_name  *string `json:"last_name"`
+			Password   *string `json:"Password"`
+			Email      *string `json:"email"`
+			Phone      *string `json:"phone"`
+			User_type  *string `json:"user_type"`
+		}
 
-		var user models.User // Create a User model instance
-
-		// Parse and bind the JSON request body to the user struct
-		if err := c.BindJSON(&user); err != nil {
+		// Parse and bind the JSON request body to the request struct
+		if err := c.BindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		// Validate the user struct using the validator
-		validationErr := validate.Struct(user)
-		if validationErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
-			return
+		user := models.User{
+			First_name: request.First_name,
+			Last_name:  request.Last_name,
+			Password:   request.Password,
+			Email:      request.Email,
+			Phone:      request.Phone,
+			User_type:  request.User_type,
 		}
 
-		// Check if the email already exists in the database
-		count, err := userCollection.CountDocuments(ctx, bson.M{"email": user.Email})
-		if err != nil {
-			log.Panic(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking for the email"})
-			return
+		// Validate and store the user. The first ADMIN can be created by sending the
+		// configured bootstrap token; everyone else signs up as a USER
+		var err error
+		if bootstrapToken := c.GetHeader("X-Bootstrap-Token"); bootstrapToken != "" {
+			user, err = service.BootstrapAdmin(ctx, user, bootstrapToken)
+		} else {
+			user, err = service.Signup(ctx, user)
 		}
-
-		// Hash the user's password before saving it
-		password := HashPassword(*user.Password)
-		user.Password = &password
-
-		// Check if the phone number already exists in the database
-		count, err = userCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
 		if err != nil {
-			log.Panic(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while checking for the phone number"})
-			return
-		}
-
-		// If email or phone already exists, return an error
-		if count > 0 {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "this email or phone number already exists"})
+			respondServiceError(c, err)
 			return
 		}
 
-		// Set timestamps and generate unique identifiers for the user
-		user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		user.ID = primitive.NewObjectID()
-		user.User_id = user.ID.Hex()
-
-		// Generate JWT tokens for the user
-		token, refreshToken, _ := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, *&user.User_id)
-		user.Token = &token
-		user.Refresh_token = &refreshToken
-
-		// Insert the user details into the database
-		resultInsertionNumber, insertErr := userCollection.InsertOne(ctx, user)
-		if insertErr != nil {
-			msg := fmt.Sprintf("User item was not created")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
-			return
-		}
-
-		// Respond with a success status and the insertion result
-		c.JSON(http.StatusOK, resultInsertionNumber)
+		// Respond with a success status and the id of the new user
+		c.JSON(http.StatusOK, gin.H{"InsertedID": user.ID})
 	}
 }
 
@@ -123,138 +115,301 @@ func Login() gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel() // Ensure context cancellation at the end of the function
 
-		var user models.User      // Create a User model instance for incoming login details
-		var foundUser models.User // Create a User model instance for the found user details
+		var user models.User // Create a User model instance for incoming login details
 
 		// Parse and bind the JSON request body to the user struct
 		if err := c.BindJSON(&user); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if user.Email == nil || user.Password == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email and password are required"})
+			return
+		}
 
-		// Find the user in the database using their email
-		err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
-		defer cancel()
+		// Check the credentials and start a session for this device
+		deviceToken, _ := c.Cookie(helper.DeviceCookieName)
+		foundUser, deviceToken, err := service.Login(ctx, *user.Email, *user.Password, c.Request.UserAgent(), c.ClientIP(), deviceToken)
 		if err != nil {
-			// If the user is not found or an error occurs, return an error response
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "email or password is incorrect"})
+			respondServiceError(c, err)
 			return
 		}
+		respondLogin(c, foundUser, deviceToken)
+	}
+}
 
-		// Verify the password provided with the stored hashed password
-		passwordIsValid, msg := VerifyPassword(*user.Password, *foundUser.Password)
+// VerifyLogin returns a Gin handler function that completes a login which had to be
+// confirmed, with the code emailed to the user or one from their authenticator app, and
+// responds like Login.
+func VerifyLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
-		if passwordIsValid != true {
-			// If the password verification fails, return an error response
-			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Challenge_token string `json:"challenge_token"`
+			Method          string `json:"method"`
+			Code            string `json:"code"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Challenge_token == "" || request.Method == "" || request.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "challenge_token, method and code are required"})
 			return
 		}
 
-		// Check if the user is found based on the retrieved email
-		if foundUser.Email == nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+		user, deviceToken, err := service.VerifyLogin(ctx, request.Challenge_token, request.Method, request.Code)
+		if err != nil {
+			respondServiceError(c, err)
+			return
 		}
+		respondLogin(c, user, deviceToken)
+	}
+}
+
+// respondLogin answers a successful login of user from the device deviceToken belongs to.
+func respondLogin(c *gin.Context, user models.User, deviceToken string) {
+	// Remember this device so failed logins from elsewhere can't lock the user out of it
+	helper.SetDeviceCookie(c, deviceToken)
+
+	// In browser mode the tokens go into HttpOnly cookies instead of the response body
+	if helper.IsBrowserMode(c) {
+		csrfToken, err := helper.SetAuthCookies(c, *user.Token, *user.Refresh_token)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while setting the session cookies"})
+			return
+		}
+		user.Token = nil
+		user.Refresh_token = nil
+		c.JSON(http.StatusOK, gin.H{"user": user, "csrf_token": csrfToken})
+		return
+	}
 
-		// Generate JWT tokens for the authenticated user
-		token, refreshToken, _ := helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id)
+	// Respond with the authenticated user's details and the new tokens
+	c.JSON(http.StatusOK, user)
+}
 
-		// Update user's tokens in the database
-		helper.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+// Refresh returns a Gin handler function that exchanges a refresh token for a new token pair.
+// The refresh token is read from the JSON body, or from the refresh cookie for browser clients,
+// in which case the CSRF token must be sent as well and the new pair is set as cookies again.
+func Refresh() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+
+		var request struct {
+			Refresh_token string `json:"refresh_token"`
+		}
+		c.ShouldBindJSON(&request)
+
+		// Fall back to the refresh cookie, which needs the same CSRF proof as any other cookie request
+		fromCookie := false
+		if request.Refresh_token == "" {
+			cookie, err := c.Cookie(helper.RefreshTokenCookieName)
+			if err != nil || cookie == "" {
+				helper.AbortUnauthorized(c, "", "no refresh token provided")
+				return
+			}
+			if !helper.VerifyCSRF(c) {
+				helper.AbortForbidden(c, "missing or invalid CSRF token")
+				return
+			}
+			request.Refresh_token = cookie
+			fromCookie = true
+		}
 
-		// Retrieve the updated user details from the database
-		err = userCollection.FindOne(ctx, bson.M{"user_id": foundUser.User_id}).Decode(&foundUser)
+		// Validate the refresh token and rotate the pair
+		token, refreshToken, err := service.Refresh(ctx, request.Refresh_token)
 		if err != nil {
-			// If an error occurs during fetching updated user details, return an error response
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			var serviceErr *service.Error
+			if errors.As(err, &serviceErr) && serviceErr.Code == service.Unauthenticated {
+				helper.AbortUnauthorized(c, "invalid_token", serviceErr.Message)
+				return
+			}
+			respondServiceError(c, err)
+			return
+		}
+
+		if fromCookie || helper.IsBrowserMode(c) {
+			csrfToken, err := helper.SetAuthCookies(c, token, refreshToken)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while setting the session cookies"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"csrf_token": csrfToken})
 			return
 		}
 
-		// Respond with the authenticated user's details
-		c.JSON(http.StatusOK, foundUser)
+		c.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
+	}
+}
+
+// Logout returns a Gin handler function that signs out the current session
+// and clears the browser mode cookies.
+func Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := helper.RevokeSessions(c.GetString("uid"), bson.M{"session_id": c.GetString("session_id")}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while signing out"})
+			return
+		}
+		recordAudit(c, helper.AuditLogout, c.GetString("uid"), map[string]string{"session_id": c.GetString("session_id")})
+		helper.ClearAuthCookies(c)
+		c.JSON(http.StatusOK, gin.H{"message": "logged out"})
 	}
 }
 
 // GetUsers returns a Gin handler function for retrieving a paginated list of users.
-// It checks if the user making the request has ADMIN privileges using CheckUserType helper function.
-// It retrieves users from the database based on pagination parameters (recordPerPage, page).
+// Only ADMIN users may list users; the paging comes from the recordPerPage and page
+// query parameters.
 func GetUsers() gin.HandlerFunc {
 	// Return an anonymous Gin handler function
 	return func(c *gin.Context) {
-		// Check if the user has ADMIN privileges, return error if not authorized
-		if err := helper.CheckUserType(c, "ADMIN"); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		// Create a context with a timeout of 100 seconds
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel() // Ensure context cancellation at the end of the function
+
+		// Parse query parameters for pagination; a missing or invalid recordPerPage falls back
+		// to the default, but a page that was given has to be a positive number
+		recordPerPage, _ := strconv.Atoi(c.Query("recordPerPage"))
+		page := 1
+		if value := c.Query("page"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive integer"})
+				return
+			}
+			page = parsed
+		}
+
+		result, err := service.ListUsers(ctx, c, page, recordPerPage)
+		if err != nil {
+			respondServiceError(c, err)
 			return
 		}
 
-		// Create a context with a timeout of 100 seconds
+		// Return the paginated user data in the response
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// SetUserRole returns a Gin handler function that lets an ADMIN promote a user to ADMIN
+// or demote them to USER.
+func SetUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		defer cancel() // Ensure context cancellation at the end of the function
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
 
-		// Parse query parameters for pagination: recordPerPage and page
-		recordPerPage, err := strconv.Atoi(c.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10 // Default records per page if not provided or invalid
+		var request struct {
+			User_type string `json:"user_type"`
 		}
-		page, err1 := strconv.Atoi(c.Query("page"))
-		if err1 != nil || page < 1 {
-			page = 1 // Default page number if not provided or invalid
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		// Calculate the starting index for pagination
-		startIndex := (page - 1) * recordPerPage
-		startIndex, err = strconv.Atoi(c.Query("startIndex")) // Overwrite startIndex if provided in query (Unused in subsequent code)
-
-		// Define MongoDB aggregation pipeline stages for user retrieval
-		matchStage := bson.D{{"$match", bson.D{{}}}} // Match all documents
-		groupStage := bson.D{{"$group", bson.D{
-			{"_id", bson.D{{"_id", "null"}}},      // Grouping by null to aggregate all documents
-			{"total_count", bson.D{{"$sum", 1}}},  // Count total documents
-			{"data", bson.D{{"$push", "$$ROOT"}}}, // Push all documents to 'data' array
-		}}}
-		projectStage := bson.D{
-			{"$project", bson.D{
-				{"_id", 0},         // Exclude _id field from output
-				{"total_count", 1}, // Include total_count field in output
-				{"user_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}}, // Pagination using $slice
-			}},
+		user, err := service.ChangeRole(ctx, c, c.Param("user_id"), request.User_type)
+		if err != nil {
+			respondServiceError(c, err)
+			return
 		}
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// SuspendUser returns a Gin handler function that lets an ADMIN suspend a user.
+func SuspendUser() gin.HandlerFunc {
+	return setUserStatus(models.UserSuspended)
+}
+
+// ReactivateUser returns a Gin handler function that lets an ADMIN reactivate a suspended,
+// pending or soft-deleted user.
+func ReactivateUser() gin.HandlerFunc {
+	return setUserStatus(models.UserActive)
+}
+
+// DeleteUser returns a Gin handler function that lets an ADMIN soft-delete a user. The
+// user is purged for good once the retention period has passed.
+func DeleteUser() gin.HandlerFunc {
+	return setUserStatus(models.UserDeleted)
+}
 
-		// Execute aggregation pipeline to retrieve paginated user data
-		result, err := userCollection.Aggregate(ctx, mongo.Pipeline{matchStage, groupStage, projectStage})
+// setUserStatus handles the user lifecycle endpoints. The reason comes from the JSON body,
+// or from the reason query parameter for clients that can't send a body with DELETE.
+func setUserStatus(status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
 
-		// Handle errors if aggregation fails
+		var request struct {
+			Reason string `json:"reason"`
+		}
+		c.ShouldBindJSON(&request)
+		if request.Reason == "" {
+			request.Reason = c.Query("reason")
+		}
+
+		user, err := service.SetUserStatus(ctx, c, c.Param("user_id"), status, request.Reason)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "error occurred while listing user items"})
+			respondServiceError(c, err)
 			return
 		}
+		c.JSON(http.StatusOK, user)
+	}
+}
 
-		// Parse aggregation results into bson.M slices
-		var allUsers []bson.M
-		if err = result.All(ctx, &allUsers); err != nil {
-			log.Fatal(err)
-		}
+// UnlockUser returns a Gin handler function that lets an ADMIN lift a lock or a lockout
+// after failed logins from a user.
+func UnlockUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
 
-		// Return the paginated user data in the response
-		c.JSON(http.StatusOK, allUsers[0])
+		user, err := service.UnlockAccount(ctx, c, c.Param("user_id"))
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, user)
 	}
 }
 
-func GetUser() gin.HandlerFunc {
+// ImpersonateUser returns a Gin handler function that lets an ADMIN get a short-lived
+// token to act as a USER. The reason is required and recorded in the audit log.
+func ImpersonateUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userId := c.Param("user_id")
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+		ctx = helper.WithRequestInfo(ctx, c.ClientIP(), c.Request.UserAgent())
 
-		if err := helper.MatchUserTypeToUid(c, userId); err != nil {
+		var request struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.BindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 
-		var user models.User
-		err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+		impersonation, err := service.Impersonate(ctx, c, c.Param("user_id"), request.Reason, c.Request.UserAgent(), c.ClientIP())
+		if err != nil {
+			respondServiceError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, impersonation)
+	}
+}
+
+func GetUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
+
+		user, err := service.GetUser(ctx, c, c.Param("user_id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondServiceError(c, err)
 			return
 		}
 		c.JSON(http.StatusOK, user)
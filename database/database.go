@@ -2,18 +2,20 @@ package database
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"io/fs"
 	"log"
 	"os"
 	"time"
 )
 
 func DBinstance() *mongo.Client {
+	// The settings may come from the environment alone, as they do in tests and containers
 	err := godotenv.Load(".env")
-	if err != nil {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Fatal("Error loading .env file")
 	}
 
@@ -27,7 +29,8 @@ func DBinstance() *mongo.Client {
 		log.Fatal(err)
 	}
 
-	fmt.Println("Connected to MongoDB!")
+	// log to stderr so tools like authctl can print JSON on stdout
+	log.Println("Connected to MongoDB!")
 
 	return client
 }
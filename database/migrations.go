@@ -0,0 +1,216 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a one-off change to the auth database. Applied migrations are recorded in
+// the migration collection by id so each one runs exactly once.
+type Migration struct {
+	Id          string
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Migrations lists every migration in the order it must be applied. Append new ones at
+// the end and never change the id of one that has shipped.
+var Migrations = []Migration{
+	{
+		Id:          "0001_user_indexes",
+		Description: "unique indexes on user email and user_id",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("user").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"email": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"user_id": 1}, Options: options.Index().SetUnique(true)},
+			})
+			return err
+		},
+	},
+	{
+		Id:          "0002_drop_stored_tokens",
+		Description: "remove the tokens older versions stored on user documents",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("user").UpdateMany(ctx,
+				bson.M{"$or": []bson.M{{"token": bson.M{"$exists": true}}, {"refresh_token": bson.M{"$exists": true}}}},
+				bson.M{"$unset": bson.M{"token": "", "refresh_token": ""}},
+			)
+			return err
+		},
+	},
+	{
+		Id:          "0003_session_and_key_indexes",
+		Description: "indexes for session, api key and signing key lookups",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if _, err := db.Collection("session").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"session_id": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"user_id": 1}},
+			}); err != nil {
+				return err
+			}
+			if _, err := db.Collection("api_key").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"prefix": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"user_id": 1}},
+			}); err != nil {
+				return err
+			}
+			_, err := db.Collection("signing_key").Indexes().CreateOne(ctx,
+				mongo.IndexModel{Keys: bson.M{"kid": 1}, Options: options.Index().SetUnique(true)},
+			)
+			return err
+		},
+	},
+	{
+		Id:          "0004_audit_indexes",
+		Description: "indexes for filtering the audit log",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("audit").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "action", Value: 1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.M{"created_at": 1}},
+			})
+			return err
+		},
+	},
+	{
+		Id:          "0005_audit_chain_indexes",
+		Description: "unique sequence per audit stream, and checkpoint lookups",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Events written before the chain existed have no stream and are left out
+			if _, err := db.Collection("audit").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "stream", Value: 1}, {Key: "sequence", Value: 1}},
+				Options: options.Index().SetUnique(true).
+					SetPartialFilterExpression(bson.M{"stream": bson.M{"$exists": true}}),
+			}); err != nil {
+				return err
+			}
+			_, err := db.Collection("audit_checkpoint").Indexes().CreateOne(ctx,
+				mongo.IndexModel{Keys: bson.D{{Key: "stream", Value: 1}, {Key: "sequence", Value: 1}}},
+			)
+			return err
+		},
+	},
+	{
+		Id:          "0006_password_reset_indexes",
+		Description: "password reset token lookups, removed once expired",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("password_reset").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"user_id": 1}},
+				{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+	},
+	{
+		Id:          "0007_known_device_indexes",
+		Description: "known devices per user and login challenges, removed once expired",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("known_device").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "device_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "fingerprint", Value: 1}}},
+				{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+			})
+			if err != nil {
+				return err
+			}
+			_, err = db.Collection("login_challenge").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+	},
+	{
+		Id:          "0008_email_change_indexes",
+		Description: "email change confirm and undo token lookups, removed once they can't be undone",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("email_change").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"undo_token_hash": 1}, Options: options.Index().SetUnique(true)},
+				{Keys: bson.M{"user_id": 1}},
+				{Keys: bson.M{"undo_expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+			})
+			return err
+		},
+	},
+	{
+		Id:          "0010_audit_time_indexes",
+		Description: "index the audit log by time then id, the order it is paged in",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			indexes := db.Collection("audit").Indexes()
+			for _, name := range []string{"action_1__id_-1", "actor_id_1__id_-1", "target_id_1__id_-1", "created_at_1"} {
+				if _, err := indexes.DropOne(ctx, name); err != nil {
+					if commandErr, ok := err.(mongo.CommandError); !ok || commandErr.Name != "IndexNotFound" {
+						return err
+					}
+				}
+			}
+			_, err := indexes.CreateMany(ctx, []mongo.IndexModel{
+				{Keys: bson.D{{Key: "action", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+				{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+			})
+			return err
+		},
+	},
+}
+
+// AppliedMigration is the record kept for a migration that has run.
+type AppliedMigration struct {
+	Id         string    `json:"id" bson:"id"`
+	Applied_at time.Time `json:"applied_at"`
+}
+
+// PendingMigrations returns the migrations that haven't been applied yet, in order.
+func PendingMigrations(ctx context.Context) ([]Migration, error) {
+	applied := map[string]bool{}
+	cursor, err := OpenCollection(Client, "auth", "migration").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []AppliedMigration
+	if err = cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		applied[record.Id] = true
+	}
+
+	var pending []Migration
+	for _, migration := range Migrations {
+		if !applied[migration.Id] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies every pending migration in order and returns the ids it applied.
+// It stops at the first failure; the failed migration is retried on the next run.
+func Migrate(ctx context.Context) ([]string, error) {
+	pending, err := PendingMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	db := Client.Database("auth")
+	applied := []string{}
+	for _, migration := range pending {
+		if err := migration.Up(ctx, db); err != nil {
+			return applied, err
+		}
+		record := AppliedMigration{Id: migration.Id, Applied_at: time.Now()}
+		if _, err := db.Collection("migration").InsertOne(ctx, record); err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration.Id)
+	}
+	return applied, nil
+}
@@ -0,0 +1,83 @@
+// Package docs holds the OpenAPI 3 description of the HTTP API. The document is embedded in the
+// binary, served at /openapi.json and compared against the registered gin routes at startup so
+// the contract can't silently drift from the handlers.
+package docs
+
+import (
+	_ "embed"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAPI is the raw OpenAPI 3 document.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+var (
+	loadOnce sync.Once
+	spec     *openapi3.T
+	loadErr  error
+)
+
+// Spec parses and validates the embedded document. It is parsed once and shared.
+func Spec() (*openapi3.T, error) {
+	loadOnce.Do(func() {
+		loader := openapi3.NewLoader()
+		spec, loadErr = loader.LoadFromData(OpenAPI)
+		if loadErr != nil {
+			return
+		}
+		loadErr = spec.Validate(loader.Context)
+	})
+	return spec, loadErr
+}
+
+// ginParam matches gin path parameters such as :user_id.
+var ginParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// OpenAPIPath converts a gin route path such as /users/:user_id to its OpenAPI form /users/{user_id}.
+func OpenAPIPath(ginPath string) string {
+	return ginParam.ReplaceAllString(ginPath, "{$1}")
+}
+
+// CheckRoutes compares the registered routes with the document and returns one line per
+// difference: routes served but not documented, and operations documented but not served.
+// An empty result means the two are in sync.
+func CheckRoutes(routes gin.RoutesInfo) ([]string, error) {
+	doc, err := Spec()
+	if err != nil {
+		return nil, err
+	}
+
+	served := map[string]bool{}
+	for _, route := range routes {
+		served[route.Method+" "+OpenAPIPath(route.Path)] = true
+	}
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths {
+		for method := range item.Operations() {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	var drift []string
+	for operation := range served {
+		if !documented[operation] {
+			drift = append(drift, "not documented: "+operation)
+		}
+	}
+	for operation := range documented {
+		if !served[operation] {
+			drift = append(drift, "not served: "+operation)
+		}
+	}
+	sort.Strings(drift)
+	return drift, nil
+}
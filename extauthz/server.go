@@ -0,0 +1,144 @@
+// Package extauthz implements the Envoy external authorization (ext_authz) gRPC API so
+// service mesh traffic can be authorized by this service.
+package extauthz
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	auth "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	envoytype "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/gin-gonic/gin"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+)
+
+// Server answers Envoy's Check calls with the same token validation as middleware.Authenticate.
+//
+// The user type a route needs is taken from the "user_type" context extension of the route's
+// ext_authz filter config, falling back to the forward auth rules for the request's host and path.
+type Server struct{}
+
+// ListenAndServe starts the ext_authz gRPC listener on addr and blocks until it fails.
+func ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer()
+	auth.RegisterAuthorizationServer(server, &Server{})
+
+	log.Println("ext_authz gRPC server listening on", addr)
+	return server.Serve(listener)
+}
+
+// Check authorizes a single request proxied by Envoy.
+func (s *Server) Check(ctx context.Context, req *auth.CheckRequest) (*auth.CheckResponse, error) {
+	attributes := req.GetAttributes()
+	httpAttributes := attributes.GetRequest().GetHttp()
+
+	// Rebuild the original request so the token extraction and CSRF checks of the HTTP
+	// middleware can be reused unchanged
+	original, err := http.NewRequest(httpAttributes.GetMethod(), httpAttributes.GetPath(), nil)
+	if err != nil {
+		return denied(http.StatusBadRequest, codes.InvalidArgument, "malformed request", ""), nil
+	}
+	for name, value := range httpAttributes.GetHeaders() {
+		original.Header.Set(name, value)
+	}
+	original.Host = httpAttributes.GetHost()
+	c := &gin.Context{Request: original}
+
+	rule := helper.MatchForwardAuthRule(original.Host, original.URL.Path)
+	if rule.Public {
+		return allowed(nil), nil
+	}
+
+	claims, authErr := middleware.VerifyRequest(c, original.Method)
+	if authErr != nil {
+		challenge := ""
+		if authErr.Status == http.StatusUnauthorized {
+			challenge = helper.BearerChallenge("error", authErr.Code, "error_description", authErr.Description)
+		}
+		code := codes.Unauthenticated
+		if authErr.Status == http.StatusForbidden {
+			code = codes.PermissionDenied
+		}
+		return denied(authErr.Status, code, authErr.Description, challenge), nil
+	}
+
+	// Apply the same user type check the HTTP handlers use
+	c.Set("user_type", claims.User_type)
+	if role := attributes.GetContextExtensions()["user_type"]; role != "" {
+		if err := helper.CheckUserType(c, role); err != nil {
+			return denied(http.StatusForbidden, codes.PermissionDenied, err.Error(), ""), nil
+		}
+	} else if !rule.AllowsUserType(claims.User_type) {
+		return denied(http.StatusForbidden, codes.PermissionDenied, "Unauthorized to access this resource", ""), nil
+	}
+
+	return allowed(claims), nil
+}
+
+func header(key string, value string) *core.HeaderValueOption {
+	return &core.HeaderValueOption{
+		Header:       &core.HeaderValue{Key: key, Value: value},
+		AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
+
+// allowed lets the request through and passes the caller's identity upstream.
+// Identity headers sent by the client are always overwritten so they can't be spoofed.
+func allowed(claims *helper.SignedDetails) *auth.CheckResponse {
+	var uid, email, userType, impersonator string
+	if claims != nil {
+		uid, email, userType = claims.Uid, claims.Email, claims.User_type
+		if claims.Act != nil {
+			impersonator = claims.Act.Sub
+		}
+	}
+
+	return &auth.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &auth.CheckResponse_OkResponse{
+			OkResponse: &auth.OkHttpResponse{
+				Headers: []*core.HeaderValueOption{
+					header("x-user-id", uid),
+					header("x-user-email", email),
+					header("x-user-type", userType),
+					header("x-impersonator-id", impersonator),
+				},
+			},
+		},
+	}
+}
+
+// denied rejects the request with the given HTTP status and JSON error body.
+func denied(httpStatus int, code codes.Code, description string, challenge string) *auth.CheckResponse {
+	body, _ := json.Marshal(gin.H{"error": description})
+
+	headers := []*core.HeaderValueOption{header("content-type", "application/json")}
+	if challenge != "" {
+		headers = append(headers, header("www-authenticate", challenge))
+	}
+
+	return &auth.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(code), Message: description},
+		HttpResponse: &auth.CheckResponse_DeniedResponse{
+			DeniedResponse: &auth.DeniedHttpResponse{
+				Status:  &envoytype.HttpStatus{Code: envoytype.StatusCode(httpStatus)},
+				Headers: headers,
+				Body:    string(body),
+			},
+		},
+	}
+}
@@ -0,0 +1,82 @@
+package grpcserver
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	authv1 "github.com/Danitilahun/GO_JWT_Authentication.git/proto/auth/v1"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+)
+
+// deviceTokenMetadata carries the device token of a client to Login and back.
+const deviceTokenMetadata = "x-device-token"
+
+type authServer struct {
+	authv1.UnimplementedAuthServiceServer
+}
+
+func (s *authServer) Signup(ctx context.Context, req *authv1.SignupRequest) (*authv1.SignupResponse, error) {
+	user, err := service.Signup(ctx, models.User{
+		First_name: &req.FirstName,
+		Last_name:  &req.LastName,
+		Password:   &req.Password,
+		Email:      &req.Email,
+		Phone:      &req.Phone,
+		User_type:  &req.UserType,
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &authv1.SignupResponse{UserId: user.User_id}, nil
+}
+
+func (s *authServer) Login(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+	userAgent, ip := clientInfo(ctx)
+	// The device token travels in metadata here, like the device cookie of the HTTP API
+	deviceToken := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(deviceTokenMetadata)) > 0 {
+		deviceToken = md.Get(deviceTokenMetadata)[0]
+	}
+	user, deviceToken, err := service.Login(ctx, req.Email, req.Password, userAgent, ip, deviceToken)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(deviceTokenMetadata, deviceToken))
+	return &authv1.LoginResponse{
+		User:         toProtoUser(user),
+		Token:        *user.Token,
+		RefreshToken: *user.Refresh_token,
+	}, nil
+}
+
+func (s *authServer) Refresh(ctx context.Context, req *authv1.RefreshRequest) (*authv1.RefreshResponse, error) {
+	token, refreshToken, err := service.Refresh(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &authv1.RefreshResponse{Token: token, RefreshToken: refreshToken}, nil
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func toProtoUser(user models.User) *authv1.User {
+	return &authv1.User{
+		UserId:    user.User_id,
+		FirstName: stringValue(user.First_name),
+		LastName:  stringValue(user.Last_name),
+		Email:     stringValue(user.Email),
+		Phone:     stringValue(user.Phone),
+		UserType:  stringValue(user.User_type),
+		CreatedAt: timestamppb.New(user.Created_at),
+		UpdatedAt: timestamppb.New(user.Updated_at),
+	}
+}
@@ -0,0 +1,157 @@
+// Package grpcserver serves the AuthService and UserService gRPC APIs defined in
+// proto/auth/v1 on top of the same service layer as the HTTP handlers.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	authv1 "github.com/Danitilahun/GO_JWT_Authentication.git/proto/auth/v1"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+)
+
+// publicMethods can be called without credentials, like /users/signup and /users/login.
+var publicMethods = map[string]bool{
+	authv1.AuthService_Signup_FullMethodName:  true,
+	authv1.AuthService_Login_FullMethodName:   true,
+	authv1.AuthService_Refresh_FullMethodName: true,
+}
+
+// NewServer creates a gRPC server with both services registered behind the auth interceptor.
+func NewServer() *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(UnaryAuthInterceptor))
+	authv1.RegisterAuthServiceServer(server, &authServer{})
+	authv1.RegisterUserServiceServer(server, &userServer{})
+	return server
+}
+
+// ListenAndServe starts the gRPC API on addr and blocks until it fails.
+func ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	log.Println("gRPC API listening on", addr)
+	return NewServer().Serve(listener)
+}
+
+type identityKey struct{}
+
+// identityFromContext returns the caller stored by UnaryAuthInterceptor.
+func identityFromContext(ctx context.Context) helper.Identity {
+	identity, _ := ctx.Value(identityKey{}).(helper.Identity)
+	return identity
+}
+
+// UnaryAuthInterceptor is the gRPC equivalent of middleware.Authenticate. It reads the
+// "authorization: Bearer <token>" metadata, accepts access tokens and API keys, and makes
+// the caller available to the handlers.
+func UnaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	// Make the caller's address and user agent available to the audit log
+	userAgent, ip := clientInfo(ctx)
+	ctx = helper.WithRequestInfo(ctx, ip, userAgent)
+
+	if publicMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if values := md.Get("authorization"); len(values) > 0 && len(values[0]) > 7 && strings.EqualFold(values[0][:7], "Bearer ") {
+		token = strings.TrimSpace(values[0][7:])
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "No Authorization header provided")
+	}
+
+	claims, msg := helper.ResolveToken(token)
+	if msg == "" && claims.Token_type == helper.RefreshToken {
+		msg = "the token is not an access token"
+	}
+	if msg != "" {
+		return nil, status.Error(codes.Unauthenticated, msg)
+	}
+
+	return handler(context.WithValue(ctx, identityKey{}, helper.ClaimsIdentity{Claims: claims}), req)
+}
+
+// toStatus maps an error from the service package to a gRPC status.
+func toStatus(err error) error {
+	var serviceErr *service.Error
+	if !errors.As(err, &serviceErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	code := codes.Internal
+	switch serviceErr.Code {
+	case service.InvalidArgument:
+		code = codes.InvalidArgument
+	case service.Unauthenticated:
+		code = codes.Unauthenticated
+	case service.PermissionDenied, service.InsufficientScope:
+		code = codes.PermissionDenied
+	case service.NotFound:
+		code = codes.NotFound
+	case service.AlreadyExists:
+		code = codes.AlreadyExists
+	case service.ResourceExhausted:
+		// Tell the client when to retry the way the Google API design guide does
+		st, err := status.New(codes.ResourceExhausted, serviceErr.Message).WithDetails(&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(time.Duration(serviceErr.RetryAfterSeconds()) * time.Second),
+		})
+		if err != nil {
+			return status.Error(codes.ResourceExhausted, serviceErr.Message)
+		}
+		return st.Err()
+	case service.StepUpRequired:
+		// There is no RPC to complete the challenge yet; clients finish it over HTTP
+		st, err := status.New(codes.Unauthenticated, serviceErr.Message).WithDetails(&errdetails.ErrorInfo{
+			Reason: "STEP_UP_REQUIRED",
+			Domain: helper.TokenIssuer,
+			Metadata: map[string]string{
+				"challenge_token": serviceErr.Challenge_token,
+				"methods":         strings.Join(serviceErr.Challenge_methods, ","),
+			},
+		})
+		if err != nil {
+			return status.Error(codes.Unauthenticated, serviceErr.Message)
+		}
+		return st.Err()
+	case service.PasswordExpired:
+		st, err := status.New(codes.FailedPrecondition, serviceErr.Message).WithDetails(&errdetails.ErrorInfo{
+			Reason:   "PASSWORD_EXPIRED",
+			Domain:   helper.TokenIssuer,
+			Metadata: map[string]string{"change_token": serviceErr.Change_token},
+		})
+		if err != nil {
+			return status.Error(codes.FailedPrecondition, serviceErr.Message)
+		}
+		return st.Err()
+	}
+	return status.Error(code, serviceErr.Message)
+}
+
+// clientInfo describes the calling device the same way the HTTP API does.
+func clientInfo(ctx context.Context) (userAgent string, ip string) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("user-agent")) > 0 {
+		userAgent = md.Get("user-agent")[0]
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		ip, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	return userAgent, ip
+}
@@ -0,0 +1,33 @@
+package grpcserver
+
+import (
+	"context"
+
+	authv1 "github.com/Danitilahun/GO_JWT_Authentication.git/proto/auth/v1"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+)
+
+type userServer struct {
+	authv1.UnimplementedUserServiceServer
+}
+
+func (s *userServer) GetUser(ctx context.Context, req *authv1.GetUserRequest) (*authv1.User, error) {
+	user, err := service.GetUser(ctx, identityFromContext(ctx), req.UserId)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toProtoUser(user), nil
+}
+
+func (s *userServer) ListUsers(ctx context.Context, req *authv1.ListUsersRequest) (*authv1.ListUsersResponse, error) {
+	page, err := service.ListUsers(ctx, identityFromContext(ctx), int(req.Page), int(req.RecordPerPage))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	response := &authv1.ListUsersResponse{TotalCount: page.Total_count}
+	for _, user := range page.User_items {
+		response.Users = append(response.Users, toProtoUser(user))
+	}
+	return response, nil
+}
@@ -1,34 +1,82 @@
 package helper
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
 	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
 	"github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // SignedDetails represents a structure combining user-specific details and standard JWT claims.
 // It includes fields for Email, First_name, Last_name, Uid, and User_type
 // to capture user information, along with jwt.StandardClaims for standard JWT metadata.
+// Scopes is only set when the caller authenticated with a personal API key; an empty
+// list means the caller has the full access of an interactive session.
+// Session_id ties the token to the login session it was issued for, and Token_type
+// tells access tokens apart from refresh tokens.
+// Act is only set on impersonation tokens and names the ADMIN acting as the user (RFC 8693).
+// Auth_time and Amr say when and how the user last proved who they are on the session, as
+// in OpenID Connect; they are missing on tokens of sessions from before they existed.
 type SignedDetails struct {
 	Email      string
 	First_name string
 	Last_name  string
 	Uid        string
 	User_type  string
+	Scopes     []string `json:"scopes,omitempty"`
+	Session_id string   `json:"sid,omitempty"`
+	Token_type string   `json:"typ,omitempty"`
+	Act        *Actor   `json:"act,omitempty"`
+	Auth_time  int64    `json:"auth_time,omitempty"`
+	Amr        []string `json:"amr,omitempty"`
 	jwt.StandardClaims
 }
 
+// Actor is the RFC 8693 act claim: the party acting on behalf of the token's subject.
+type Actor struct {
+	Sub   string `json:"sub"`
+	Email string `json:"email,omitempty"`
+}
+
+// Token types carried in the typ claim. APIKeyToken is never signed into a JWT; it marks
+// the claims resolved from a personal API key. PasswordChangeToken is issued instead of a
+// token pair when the password has expired, and is only good for choosing a new one.
+const (
+	AccessToken         = "access"
+	RefreshToken        = "refresh"
+	APIKeyToken         = "api_key"
+	PasswordChangeToken = "password_change"
+)
+
 var userCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "user")
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
+
+// SECRET_KEY seals the signing keys and TOTP secrets stored in the database and keys the
+// HMACs of CSRF and device tokens, so the service refuses to start unless it is at least
+// minSecretKeyLength bytes long.
+var SECRET_KEY string = loadSecretKey()
+
+// minSecretKeyLength is the shortest SECRET_KEY accepted, 32 bytes as for an HMAC-SHA256 key.
+const minSecretKeyLength = 32
+
+func loadSecretKey() string {
+	key := os.Getenv("SECRET_KEY")
+	if key == "" {
+		log.Fatal("SECRET_KEY must be set")
+	}
+	if len(key) < minSecretKeyLength {
+		log.Fatalf("SECRET_KEY must be at least %d bytes long", minSecretKeyLength)
+	}
+	return key
+}
+
+// TokenIssuer is put in the iss claim so verifiers can check where a token came from.
+var TokenIssuer string = os.Getenv("JWT_ISSUER")
 
 // GenerateAllTokens generates JWT (JSON Web Token) and Refresh Token pair based on the provided user details.
 // It creates a signed JWT containing user-specific claims (such as email, first name, last name, user type, UID)
@@ -40,13 +88,14 @@ var SECRET_KEY string = os.Getenv("SECRET_KEY")
 //	lastName: The last name of the user.
 //	userType: The type of user (e.g., admin, regular user).
 //	uid: The unique identifier for the user.
+//	session: The login session the tokens belong to, which also says when and how the user authenticated.
 //
 // Returns:
 //
 //	signedToken: The signed JWT representing the user's details with an expiration time of 24 hours.
 //	signedRefreshToken: The signed Refresh Token with an expiration time of 7 days (168 hours).
 //	err: Any error encountered during token generation.
-func GenerateAllTokens(email string, firstName string, lastName string, userType string, uid string) (signedToken string, signedRefreshToken string, err error) {
+func GenerateAllTokens(email string, firstName string, lastName string, userType string, uid string, session models.Session) (signedToken string, signedRefreshToken string, err error) {
 	// Create JWT claims containing user-specific details and set expiration time for the access token
 	claims := &SignedDetails{
 		Email:      email,
@@ -54,30 +103,46 @@ func GenerateAllTokens(email string, firstName string, lastName string, userType
 		Last_name:  lastName,
 		Uid:        uid,
 		User_type:  userType,
+		Session_id: session.Session_id,
+		Token_type: AccessToken,
+		Amr:        session.Amr,
 		StandardClaims: jwt.StandardClaims{
+			Issuer:   TokenIssuer,
+			IssuedAt: time.Now().Unix(),
 			// Set expiration time for 24 hours from the current time
 			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(24)).Unix(),
 		},
 	}
 
-	// Create claims for Refresh Token and set expiration time for 7 days
+	if !session.Auth_time.IsZero() {
+		claims.Auth_time = session.Auth_time.Unix()
+	}
+
+	// Create claims for Refresh Token and set expiration time for 7 days.
+	// The uid and a random token id keep refresh tokens unique per user and per issue.
 	refreshClaims := &SignedDetails{
+		Uid:        uid,
+		Session_id: session.Session_id,
+		Token_type: RefreshToken,
 		StandardClaims: jwt.StandardClaims{
+			Id:       primitive.NewObjectID().Hex(),
+			Issuer:   TokenIssuer,
+			IssuedAt: time.Now().Unix(),
 			// Set expiration time for 7 days from the current time
 			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(168)).Unix(),
 		},
 	}
 
-	// Generate a signed JWT using HS256 signing method and the provided claims
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+	// Sign the JWT with the active RS256 signing key so other services can verify it from the JWKS
+	token, err := SignClaims(claims)
 	if err != nil {
 		// Handle error if token generation fails
 		log.Panic(err)
 		return
 	}
 
-	// Generate a signed Refresh Token using HS256 signing method and the refreshClaims
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(SECRET_KEY))
+	// Sign the Refresh Token with the same key
+	refreshToken, err := SignClaims(refreshClaims)
 
 	if err != nil {
 		// Handle error if Refresh Token generation fails
@@ -89,6 +154,46 @@ func GenerateAllTokens(email string, firstName string, lastName string, userType
 	return token, refreshToken, err
 }
 
+// GenerateImpersonationToken signs a short-lived access token for the user that carries
+// actor in its act claim. No refresh token is issued; the impersonation ends when the
+// token expires or its session is signed out.
+func GenerateImpersonationToken(email string, firstName string, lastName string, userType string, uid string, sessionId string, actor Actor, ttl time.Duration) (signedToken string, err error) {
+	claims := &SignedDetails{
+		Email:      email,
+		First_name: firstName,
+		Last_name:  lastName,
+		Uid:        uid,
+		User_type:  userType,
+		Session_id: sessionId,
+		Token_type: AccessToken,
+		Act:        &actor,
+		StandardClaims: jwt.StandardClaims{
+			Id:        primitive.NewObjectID().Hex(),
+			Issuer:    TokenIssuer,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+	return SignClaims(claims)
+}
+
+// GeneratePasswordChangeToken signs a short-lived token that only lets uid replace an
+// expired password. ResolveToken doesn't accept its type, so it opens no other endpoint.
+func GeneratePasswordChangeToken(email string, uid string, ttl time.Duration) (signedToken string, err error) {
+	claims := &SignedDetails{
+		Email:      email,
+		Uid:        uid,
+		Token_type: PasswordChangeToken,
+		StandardClaims: jwt.StandardClaims{
+			Id:        primitive.NewObjectID().Hex(),
+			Issuer:    TokenIssuer,
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+		},
+	}
+	return SignClaims(claims)
+}
+
 func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 
 	// The jwt.ParseWithClaims function from the Go jwt library
@@ -99,7 +204,12 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 		signedToken,
 		&SignedDetails{},
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(SECRET_KEY), nil
+			// Only accept RS256 so a token can't pick a weaker algorithm for itself
+			if token.Method != jwt.SigningMethodRS256 {
+				return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+			}
+			kid, _ := token.Header["kid"].(string)
+			return VerificationKey(kid)
 		},
 	)
 
@@ -109,69 +219,15 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	}
 
 	claims, ok := token.Claims.(*SignedDetails)
-	if !ok {
+	if !ok || !token.Valid {
 		msg = fmt.Sprintf("the token is invalid")
-		msg = err.Error()
-		return
+		return nil, msg
 	}
 
 	// Unix returns t as a Unix time, the number of seconds elapsed since January 1, 1970 UTC.
 	if claims.ExpiresAt < time.Now().Local().Unix() {
 		msg = fmt.Sprintf("token is expired")
-		msg = err.Error()
-		return
+		return nil, msg
 	}
 	return claims, msg
 }
-
-// UpdateAllTokens updates the tokens and timestamp for a user identified by their user ID in the database.
-// Parameters:
-//
-//	signedToken: The new signed JWT to be updated for the user.
-//	signedRefreshToken: The new signed Refresh Token to be updated for the user.
-//	userId: The unique identifier of the user whose tokens are to be updated.
-func UpdateAllTokens(signedToken string, signedRefreshToken string, userId string) {
-	// Create a context with a timeout of 100 seconds
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel() // Ensure context cancellation at the end of the function
-
-	// Create a slice of primitive.E to store update operations
-	var updateObj primitive.D
-
-	// Append token and refresh token update operations to the updateObj
-	updateObj = append(updateObj, bson.E{"token", signedToken})
-	updateObj = append(updateObj, bson.E{"refresh_token", signedRefreshToken})
-
-	// Get the current time and prepare an update operation for the 'updated_at' field
-	Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{"updated_at", Updated_at})
-
-	// Prepare options for the update operation, set 'Upsert' to true to insert if the document does not exist
-	upsert := true
-	filter := bson.M{"user_id": userId}
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	// Perform the update operation on the userCollection
-	_, err := userCollection.UpdateOne(
-		ctx,
-		filter,
-		bson.D{
-			{"$set", updateObj}, // Use $set operator to update the specified fields
-		},
-		&opt,
-	)
-
-	// Ensure the context is cancelled regardless of the function's flow
-	defer cancel()
-
-	// Handle error if update operation fails
-	if err != nil {
-		log.Panic(err)
-		return
-	}
-
-	// Return after successful token update
-	return
-}
@@ -0,0 +1,135 @@
+package helper
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// APIKeyPrefix marks a bearer credential as a personal API key rather than a JWT.
+const APIKeyPrefix = "gja_"
+
+// APIKeyScopes lists every scope that can be granted to an API key.
+var APIKeyScopes = []string{"users:read", "audit:read"}
+
+var apiKeyCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "api_key")
+
+// GenerateAPIKey creates a new random API key.
+// Returns:
+//
+//	key: The full key in the form gja_<prefix>_<secret>. It is shown to the user once and never stored.
+//	prefix: The public lookup prefix stored alongside the hash.
+//	hashedKey: The SHA-256 hash of the full key that is persisted.
+//	err: Any error encountered while reading random bytes.
+func GenerateAPIKey() (key string, prefix string, hashedKey string, err error) {
+	prefixBytes := make([]byte, 6)
+	if _, err = rand.Read(prefixBytes); err != nil {
+		return
+	}
+	secretBytes := make([]byte, 32)
+	if _, err = rand.Read(secretBytes); err != nil {
+		return
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = APIKeyPrefix + prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	hashedKey = HashToken(key)
+	return key, prefix, hashedKey, nil
+}
+
+// HashToken returns the hex encoded SHA-256 hash of a high-entropy credential such as an
+// API key or a refresh token. These carry enough randomness that a fast hash is sufficient.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a bearer credential looks like a personal API key.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// IsValidAPIKeyScope reports whether scope can be granted to an API key.
+func IsValidAPIKeyScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAPIKey looks up a personal API key by its prefix, checks the hash, expiry and
+// revocation, and resolves it to the same claims a JWT for its owner would carry.
+func ValidateAPIKey(key string) (claims *SignedDetails, msg string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	// Split gja_<prefix>_<secret> to get the lookup prefix
+	parts := strings.SplitN(strings.TrimPrefix(key, APIKeyPrefix), "_", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		msg = "the api key is invalid"
+		return
+	}
+
+	var apiKey models.APIKey
+	err := apiKeyCollection.FindOne(ctx, bson.M{"prefix": parts[0]}).Decode(&apiKey)
+	if err != nil {
+		msg = "the api key is invalid"
+		return
+	}
+
+	// Compare hashes in constant time so the lookup can't be used as a timing oracle
+	if subtle.ConstantTimeCompare([]byte(HashToken(key)), []byte(apiKey.Hashed_key)) != 1 {
+		msg = "the api key is invalid"
+		return
+	}
+
+	if apiKey.Revoked_at != nil {
+		msg = "the api key has been revoked"
+		return
+	}
+
+	if apiKey.Expires_at.Before(time.Now()) {
+		msg = "the api key is expired"
+		return
+	}
+
+	// Resolve the owner so the key always reflects the user's current email and type
+	var user models.User
+	err = userCollection.FindOne(ctx, bson.M{"user_id": apiKey.User_id}).Decode(&user)
+	if err != nil {
+		msg = "the api key owner no longer exists"
+		return
+	}
+	if msg = CheckUserStatus(user); msg != "" {
+		return
+	}
+
+	now := time.Now()
+	apiKeyCollection.UpdateOne(ctx, bson.M{"key_id": apiKey.Key_id}, bson.M{"$set": bson.M{"last_used_at": now}})
+
+	claims = &SignedDetails{
+		Email:      *user.Email,
+		First_name: *user.First_name,
+		Last_name:  *user.Last_name,
+		Uid:        user.User_id,
+		User_type:  *user.User_type,
+		Scopes:     apiKey.Scopes,
+		Token_type: APIKeyToken,
+	}
+	claims.Id = apiKey.Key_id
+	claims.IssuedAt = apiKey.Created_at.Unix()
+	claims.ExpiresAt = apiKey.Expires_at.Unix()
+	return claims, msg
+}
@@ -0,0 +1,329 @@
+package helper
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditStream names the hash chain this instance appends audit events to. Instances may
+// share a stream: the unique index on stream and sequence created by authctl migrate makes
+// a writer that fell behind reload the head and retry instead of forking the chain.
+var AuditStream = GetEnv("AUDIT_STREAM", "default")
+
+var auditCheckpointCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "audit_checkpoint")
+
+// auditHead caches the last event this instance knows of in AuditStream.
+var auditHead = struct {
+	sync.Mutex
+	loaded   bool
+	sequence int64
+	hash     string
+}{}
+
+// auditHashInput is what an event's hash covers, in a fixed field order.
+type auditHashInput struct {
+	Event_id   string            `json:"event_id"`
+	Stream     string            `json:"stream"`
+	Sequence   int64             `json:"sequence"`
+	Action     string            `json:"action"`
+	Actor_id   string            `json:"actor_id"`
+	Target_id  string            `json:"target_id"`
+	Ip         string            `json:"ip"`
+	User_agent string            `json:"user_agent"`
+	Outcome    string            `json:"outcome"`
+	Details    map[string]string `json:"details"`
+	Created_at string            `json:"created_at"`
+	Prev_hash  string            `json:"prev_hash"`
+}
+
+// AuditEventHash returns the hex encoded SHA-256 hash of every field of event but Hash.
+func AuditEventHash(event models.AuditEvent) string {
+	input := auditHashInput{
+		Event_id:   event.Event_id,
+		Stream:     event.Stream,
+		Sequence:   event.Sequence,
+		Action:     event.Action,
+		Actor_id:   event.Actor_id,
+		Target_id:  event.Target_id,
+		Ip:         event.Ip,
+		User_agent: event.User_agent,
+		Outcome:    event.Outcome,
+		Created_at: event.Created_at.UTC().Format(time.RFC3339Nano),
+		Prev_hash:  event.Prev_hash,
+	}
+	// A nil and an empty map are stored the same way, so hash them the same way too
+	if len(event.Details) > 0 {
+		input.Details = event.Details
+	}
+
+	// encoding/json sorts map keys, which keeps the encoding stable
+	data, _ := json.Marshal(input)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// appendAuditEvent links event to the head of AuditStream and inserts it.
+func appendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	auditHead.Lock()
+	defer auditHead.Unlock()
+
+	for attempt := 0; attempt < 5; attempt++ {
+		if !auditHead.loaded {
+			if err := loadAuditHead(ctx); err != nil {
+				return err
+			}
+		}
+
+		event.Stream = AuditStream
+		event.Sequence = auditHead.sequence + 1
+		event.Prev_hash = auditHead.hash
+		event.Hash = AuditEventHash(*event)
+
+		_, err := auditCollection.InsertOne(ctx, event)
+		if err == nil {
+			auditHead.sequence, auditHead.hash = event.Sequence, event.Hash
+			return nil
+		}
+		// Another instance appended to the stream first; catch up and try again.
+		// Any other failure may still have written the event, so reload in that case too
+		auditHead.loaded = false
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	return errors.New("too many conflicting writes to audit stream " + AuditStream)
+}
+
+// loadAuditHead reads the last event of AuditStream from the database.
+func loadAuditHead(ctx context.Context) error {
+	var last models.AuditEvent
+	opts := options.FindOne().SetSort(bson.M{"sequence": -1})
+	err := auditCollection.FindOne(ctx, bson.M{"stream": AuditStream}, opts).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	auditHead.loaded, auditHead.sequence, auditHead.hash = true, last.Sequence, last.Hash
+	return nil
+}
+
+// checkpointClaims are signed into an audit checkpoint.
+type checkpointClaims struct {
+	Stream   string `json:"stream"`
+	Sequence int64  `json:"seq"`
+	Hash     string `json:"hash"`
+	jwt.StandardClaims
+}
+
+// WriteAuditCheckpoint signs the current head of stream with the active signing key and
+// stores it. It returns nil when the stream is empty or the head is already checkpointed.
+func WriteAuditCheckpoint(ctx context.Context, stream string) (*models.AuditCheckpoint, error) {
+	var last models.AuditEvent
+	err := auditCollection.FindOne(ctx, bson.M{"stream": stream}, options.FindOne().SetSort(bson.M{"sequence": -1})).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var previous models.AuditCheckpoint
+	err = auditCheckpointCollection.FindOne(ctx, bson.M{"stream": stream}, options.FindOne().SetSort(bson.M{"sequence": -1})).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if err == nil && previous.Sequence >= last.Sequence {
+		return nil, nil
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	signature, err := SignClaims(checkpointClaims{
+		Stream:         stream,
+		Sequence:       last.Sequence,
+		Hash:           last.Hash,
+		StandardClaims: jwt.StandardClaims{Issuer: TokenIssuer, IssuedAt: now.Unix()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint := models.AuditCheckpoint{
+		ID:         primitive.NewObjectID(),
+		Stream:     stream,
+		Sequence:   last.Sequence,
+		Hash:       last.Hash,
+		Signature:  signature,
+		Created_at: now,
+	}
+	if _, err := auditCheckpointCollection.InsertOne(ctx, checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// RunAuditCheckpoints checkpoints AuditStream every interval until ctx is done.
+func RunAuditCheckpoints(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		checkpointCtx, cancel := context.WithTimeout(ctx, 100*time.Second)
+		if _, err := WriteAuditCheckpoint(checkpointCtx, AuditStream); err != nil {
+			log.Println("error occurred while writing an audit checkpoint:", err)
+		}
+		cancel()
+	}
+}
+
+// AuditStreams returns the name of every audit stream.
+func AuditStreams(ctx context.Context) ([]string, error) {
+	values, err := auditCollection.Distinct(ctx, "stream", bson.M{"stream": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	streams := []string{}
+	for _, value := range values {
+		if stream, ok := value.(string); ok {
+			streams = append(streams, stream)
+		}
+	}
+	return streams, nil
+}
+
+// AuditChainReport is the result of verifying one audit stream. When Broken is set,
+// Broken_sequence and Reason describe the first link that failed; nothing after it can be
+// trusted.
+type AuditChainReport struct {
+	Stream          string `json:"stream"`
+	Events          int64  `json:"events"`
+	Checkpoints     int    `json:"checkpoints"`
+	Last_sequence   int64  `json:"last_sequence"`
+	Last_hash       string `json:"last_hash"`
+	Broken          bool   `json:"broken"`
+	Broken_sequence int64  `json:"broken_sequence,omitempty"`
+	Broken_event_id string `json:"broken_event_id,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+}
+
+func (r *AuditChainReport) fail(sequence int64, eventId string, reason string) {
+	r.Broken, r.Broken_sequence, r.Broken_event_id, r.Reason = true, sequence, eventId, reason
+}
+
+// VerifyAuditChain walks stream from its first event, recomputing every hash and link, and
+// checks each signed checkpoint against the event it covers. It stops at the first broken
+// link. Checkpoint signatures are only accepted from trustedKeys, indexed by kid, which must
+// come from outside the database: anyone able to rewrite the chain could add a key too.
+func VerifyAuditChain(ctx context.Context, stream string, trustedKeys map[string]*rsa.PublicKey) (AuditChainReport, error) {
+	report := AuditChainReport{Stream: stream}
+
+	// Load and check the signatures of the checkpoints first; they are few
+	checkpointCursor, err := auditCheckpointCollection.Find(ctx, bson.M{"stream": stream}, options.Find().SetSort(bson.M{"sequence": 1}))
+	if err != nil {
+		return report, err
+	}
+	var checkpoints []models.AuditCheckpoint
+	if err = checkpointCursor.All(ctx, &checkpoints); err != nil {
+		return report, err
+	}
+	report.Checkpoints = len(checkpoints)
+	for _, checkpoint := range checkpoints {
+		if reason := verifyCheckpointSignature(checkpoint, trustedKeys); reason != "" {
+			report.fail(checkpoint.Sequence, "", reason)
+			return report, nil
+		}
+	}
+
+	cursor, err := auditCollection.Find(ctx, bson.M{"stream": stream}, options.Find().SetSort(bson.M{"sequence": 1}))
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	expected, previousHash, next := int64(1), "", 0
+	for cursor.Next(ctx) {
+		var event models.AuditEvent
+		if err := cursor.Decode(&event); err != nil {
+			return report, err
+		}
+
+		switch {
+		case event.Sequence != expected:
+			report.fail(expected, "", fmt.Sprintf("event %d is missing; the next event has sequence %d", expected, event.Sequence))
+		case event.Prev_hash != previousHash:
+			report.fail(event.Sequence, event.Event_id, "prev_hash doesn't match the hash of the previous event")
+		case AuditEventHash(event) != event.Hash:
+			report.fail(event.Sequence, event.Event_id, "the event's content doesn't match its hash")
+		case next < len(checkpoints) && checkpoints[next].Sequence == event.Sequence && checkpoints[next].Hash != event.Hash:
+			report.fail(event.Sequence, event.Event_id, "the event doesn't match the signed checkpoint")
+		}
+		if report.Broken {
+			return report, nil
+		}
+
+		for next < len(checkpoints) && checkpoints[next].Sequence <= event.Sequence {
+			next++
+		}
+		report.Events++
+		report.Last_sequence, report.Last_hash = event.Sequence, event.Hash
+		previousHash = event.Hash
+		expected++
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+
+	// A checkpoint past the last event means the end of the stream was cut off
+	if next < len(checkpoints) {
+		report.fail(report.Last_sequence+1, "", fmt.Sprintf("events after %d are missing; a checkpoint covers up to %d", report.Last_sequence, checkpoints[len(checkpoints)-1].Sequence))
+	}
+	return report, nil
+}
+
+// verifyCheckpointSignature returns why checkpoint's signature is invalid or wasn't made
+// with one of trustedKeys, or an empty string.
+func verifyCheckpointSignature(checkpoint models.AuditCheckpoint, trustedKeys map[string]*rsa.PublicKey) string {
+	claims := &checkpointClaims{}
+	untrusted := ""
+	token, err := jwt.ParseWithClaims(checkpoint.Signature, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, found := trustedKeys[kid]
+		if !found {
+			untrusted = kid
+			return nil, errors.New("untrusted signing key")
+		}
+		return key, nil
+	})
+	if untrusted != "" {
+		return "the checkpoint is signed with key " + untrusted + ", which isn't trusted"
+	}
+	if err != nil || !token.Valid {
+		return "the checkpoint's signature is invalid"
+	}
+	if claims.Stream != checkpoint.Stream || claims.Sequence != checkpoint.Sequence || claims.Hash != checkpoint.Hash {
+		return "the checkpoint doesn't match what was signed"
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Audit actions.
+const (
+	AuditSignup                 = "user.signup"
+	AuditLogin                  = "auth.login"
+	AuditLogout                 = "auth.logout"
+	AuditTokenRefreshed         = "token.refreshed"
+	AuditTokenRevoked           = "token.revoked"
+	AuditSessionRevoked         = "session.revoked"
+	AuditAPIKeyCreated          = "api_key.created"
+	AuditAPIKeyRevoked          = "api_key.revoked"
+	AuditRoleChanged            = "user.role_changed"
+	AuditAdminCreated           = "user.admin_created"
+	AuditAdminBootstrap         = "user.admin_bootstrapped"
+	AuditUserSuspended          = "user.suspended"
+	AuditUserReactivated        = "user.reactivated"
+	AuditUserDeleted            = "user.deleted"
+	AuditUserPurged             = "user.purged"
+	AuditUserLocked             = "user.locked"
+	AuditUserUnlocked           = "user.unlocked"
+	AuditUserLockedOut          = "user.locked_out"
+	AuditPasswordReset          = "user.password_reset"
+	AuditPasswordChanged        = "user.password_changed"
+	AuditPasswordResetRequested = "user.password_reset_requested"
+	AuditImpersonation          = "user.impersonated"
+	AuditNewDevice              = "auth.new_device"
+	AuditLoginVerified          = "auth.login_verified"
+	AuditTOTPEnabled            = "user.totp_enabled"
+	AuditTOTPDisabled           = "user.totp_disabled"
+	AuditReauthenticated        = "auth.reauthenticated"
+	AuditEmailChangeRequested   = "user.email_change_requested"
+	AuditEmailChanged           = "user.email_changed"
+	AuditEmailChangeUndone      = "user.email_change_undone"
+)
+
+// Audit outcomes.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditLogFile, set with AUDIT_LOG_FILE, is a file every audit event is also appended to
+// as one JSON object per line, for shipping to a log pipeline.
+var AuditLogFile = GetEnv("AUDIT_LOG_FILE", "")
+
+var auditCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "audit")
+
+var auditFile = struct {
+	sync.Mutex
+	file *os.File
+}{}
+
+type requestInfoKey struct{}
+
+// RequestInfo describes where a request came from, for the audit log.
+type RequestInfo struct {
+	Ip         string
+	User_agent string
+}
+
+// WithRequestInfo returns a copy of ctx that carries the caller's IP address and user agent,
+// so service functions can record them without taking them as arguments.
+func WithRequestInfo(ctx context.Context, ip string, userAgent string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, RequestInfo{Ip: ip, User_agent: userAgent})
+}
+
+// RequestInfoFromContext returns the request info stored by WithRequestInfo, if any.
+func RequestInfoFromContext(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// RecordAuditEvent appends an event to the audit log. The id and time are always set here;
+// the IP address and user agent are taken from ctx when the event has none, and a missing
+// outcome means success. Actor_id is the user who acted, or the tool that did, such as
+// "authctl". Failures are logged and returned but never stop the audited action.
+func RecordAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	event.ID = primitive.NewObjectID()
+	event.Event_id = event.ID.Hex()
+	// Mongo keeps milliseconds, so drop the rest to read back exactly what was written
+	event.Created_at = time.Now().UTC().Truncate(time.Millisecond)
+	if event.Outcome == "" {
+		event.Outcome = AuditSuccess
+	}
+	info := RequestInfoFromContext(ctx)
+	if event.Ip == "" {
+		event.Ip = info.Ip
+	}
+	if event.User_agent == "" {
+		event.User_agent = info.User_agent
+	}
+
+	// Write even if the request's context is already done, so no event is lost
+	var insertCtx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	// Write to both sinks even if one of them fails
+	err := appendAuditEvent(insertCtx, &event)
+	if err != nil {
+		log.Println("error occurred while recording audit event", event.Action+":", err)
+	}
+	if fileErr := writeAuditLogFile(event); fileErr != nil {
+		log.Println("error occurred while writing the audit log file:", fileErr)
+		if err == nil {
+			err = fileErr
+		}
+	}
+	return err
+}
+
+// writeAuditLogFile appends event to AUDIT_LOG_FILE as a JSON line.
+func writeAuditLogFile(event models.AuditEvent) error {
+	if AuditLogFile == "" {
+		return nil
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	auditFile.Lock()
+	defer auditFile.Unlock()
+	if auditFile.file == nil {
+		file, err := os.OpenFile(AuditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		auditFile.file = file
+	}
+	_, err = auditFile.file.Write(append(line, '\n'))
+	return err
+}
@@ -2,10 +2,67 @@ package helper
 
 import (
 	"errors"
-	"github.com/gin-gonic/gin"
+	"strconv"
+	"time"
 )
 
-func CheckUserType(c *gin.Context, role string) (err error) {
+// Identity is anything carrying the values middleware.Authenticate stores for a request
+// ("uid", "user_type", "auth_method", "scopes", ...). *gin.Context satisfies it, and
+// ClaimsIdentity lets the same checks run outside of gin, e.g. in the gRPC server.
+type Identity interface {
+	GetString(key string) string
+	GetStringSlice(key string) []string
+}
+
+// ClaimsIdentity exposes validated token claims under the gin context keys.
+type ClaimsIdentity struct {
+	Claims *SignedDetails
+}
+
+func (i ClaimsIdentity) GetString(key string) string {
+	switch key {
+	case "email":
+		return i.Claims.Email
+	case "first_name":
+		return i.Claims.First_name
+	case "last_name":
+		return i.Claims.Last_name
+	case "uid":
+		return i.Claims.Uid
+	case "user_type":
+		return i.Claims.User_type
+	case "session_id":
+		return i.Claims.Session_id
+	case "act_sub":
+		if i.Claims.Act != nil {
+			return i.Claims.Act.Sub
+		}
+		return ""
+	case "auth_method":
+		if i.Claims.Token_type == APIKeyToken {
+			return "api_key"
+		}
+		return "jwt"
+	case "auth_time":
+		if i.Claims.Auth_time != 0 {
+			return strconv.FormatInt(i.Claims.Auth_time, 10)
+		}
+		return ""
+	}
+	return ""
+}
+
+func (i ClaimsIdentity) GetStringSlice(key string) []string {
+	switch key {
+	case "scopes":
+		return i.Claims.Scopes
+	case "amr":
+		return i.Claims.Amr
+	}
+	return nil
+}
+
+func CheckUserType(c Identity, role string) (err error) {
 	userType := c.GetString("user_type")
 	err = nil
 	if userType != role {
@@ -15,7 +72,7 @@ func CheckUserType(c *gin.Context, role string) (err error) {
 	return err
 }
 
-func MatchUserTypeToUid(c *gin.Context, userId string) (err error) {
+func MatchUserTypeToUid(c Identity, userId string) (err error) {
 
 	userType := c.GetString("user_type")
 	uid := c.GetString("uid")
@@ -28,3 +85,64 @@ func MatchUserTypeToUid(c *gin.Context, userId string) (err error) {
 	err = CheckUserType(c, userType)
 	return err
 }
+
+// CheckScope verifies that the caller may use the given scope.
+// Interactive sessions carry no scopes and have full access, while
+// API keys are limited to the scopes they were created with.
+func CheckScope(c Identity, scope string) (err error) {
+	if c.GetString("auth_method") != "api_key" {
+		return nil
+	}
+	for _, s := range c.GetStringSlice("scopes") {
+		if s == scope {
+			return nil
+		}
+	}
+	err = errors.New("API key is missing the " + scope + " scope")
+	return err
+}
+
+// CheckInteractiveSession rejects callers that authenticated with an API key.
+// It guards operations such as managing API keys that should need a real login.
+func CheckInteractiveSession(c Identity) (err error) {
+	if c.GetString("auth_method") == "api_key" {
+		err = errors.New("this action can't be performed with an API key")
+		return err
+	}
+	return nil
+}
+
+// CheckNotImpersonating rejects callers using an impersonation token. It guards actions
+// such as changing credentials or managing other users that an ADMIN acting as someone
+// else must not take on their behalf.
+func CheckNotImpersonating(c Identity) (err error) {
+	if c.GetString("act_sub") != "" {
+		err = errors.New("this action can't be performed while impersonating a user")
+		return err
+	}
+	return nil
+}
+
+// CheckRecentAuth rejects callers that haven't proved who they are within maxAge, or, when
+// methods are given, didn't use one of them to do so. It guards sensitive actions such as
+// deleting an account; the caller can meet it by reauthenticating. API keys and
+// impersonation tokens never carry an authentication time, so they are always rejected.
+func CheckRecentAuth(c Identity, maxAge time.Duration, methods []string) (err error) {
+	authTime, parseErr := strconv.ParseInt(c.GetString("auth_time"), 10, 64)
+	if parseErr != nil || time.Since(time.Unix(authTime, 0)) > maxAge {
+		err = errors.New("this action needs a recent sign-in; reauthenticate and try again")
+		return err
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+	for _, used := range c.GetStringSlice("amr") {
+		for _, method := range methods {
+			if used == method {
+				return nil
+			}
+		}
+	}
+	err = errors.New("this action needs a sign-in with a stronger method; reauthenticate and try again")
+	return err
+}
@@ -0,0 +1,125 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Names of the cookies used by browser mode. The access and refresh cookies are HttpOnly;
+// the CSRF cookie is readable by the SPA so it can echo it back in the CSRF header.
+var (
+	AccessTokenCookieName  = GetEnv("AUTH_COOKIE_NAME", "access_token")
+	RefreshTokenCookieName = GetEnv("AUTH_REFRESH_COOKIE_NAME", "refresh_token")
+	CSRFCookieName         = GetEnv("AUTH_CSRF_COOKIE_NAME", "csrf_token")
+)
+
+// CSRFHeaderName is the header a browser client must copy the CSRF cookie into on
+// state-changing requests.
+const CSRFHeaderName = "X-CSRF-Token"
+
+// RefreshCookiePath keeps the refresh cookie off requests outside /users, where the
+// refresh and logout endpoints live.
+const RefreshCookiePath = "/users"
+
+var cookieDomain = GetEnv("AUTH_COOKIE_DOMAIN", "")
+var cookieSecure = GetEnvBool("AUTH_COOKIE_SECURE", true)
+
+// IsBrowserMode reports whether the client asked for cookie based tokens with "X-Auth-Mode: browser".
+func IsBrowserMode(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader("X-Auth-Mode"), "browser")
+}
+
+// cookieSameSite maps AUTH_COOKIE_SAMESITE to an http.SameSite value, defaulting to Strict.
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(GetEnv("AUTH_COOKIE_SAMESITE", "strict")) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+func setCookie(c *gin.Context, name string, value string, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cookieDomain,
+		MaxAge:   maxAge,
+		Secure:   cookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(),
+	})
+}
+
+// SetAuthCookies stores the token pair in HttpOnly cookies and issues a fresh CSRF token.
+// The CSRF token is also returned so it can be included in the response body.
+func SetAuthCookies(c *gin.Context, signedToken string, signedRefreshToken string) (csrfToken string, err error) {
+	csrfToken, err = GenerateCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	setCookie(c, AccessTokenCookieName, signedToken, "/", 24*60*60, true)
+	setCookie(c, RefreshTokenCookieName, signedRefreshToken, RefreshCookiePath, 7*24*60*60, true)
+	setCookie(c, CSRFCookieName, csrfToken, "/", 7*24*60*60, false)
+	return csrfToken, nil
+}
+
+// ClearAuthCookies expires every cookie set by SetAuthCookies.
+func ClearAuthCookies(c *gin.Context) {
+	setCookie(c, AccessTokenCookieName, "", "/", -1, true)
+	setCookie(c, RefreshTokenCookieName, "", RefreshCookiePath, -1, true)
+	setCookie(c, CSRFCookieName, "", "/", -1, false)
+}
+
+// GenerateCSRFToken returns a random nonce followed by its HMAC under SECRET_KEY.
+// Signing the nonce stops an attacker who can plant cookies (e.g. from a sibling
+// subdomain) from choosing a CSRF value of their own.
+func GenerateCSRFToken() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	encodedNonce := base64.RawURLEncoding.EncodeToString(nonce)
+	return encodedNonce + "." + signCSRFNonce(encodedNonce), nil
+}
+
+func signCSRFNonce(nonce string) string {
+	mac := hmac.New(sha256.New, []byte(SECRET_KEY))
+	mac.Write([]byte("csrf:" + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IsSafeMethod reports whether the HTTP method can't change state and so needs no CSRF token.
+func IsSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// VerifyCSRF implements the signed double-submit check: the CSRF header must match the CSRF
+// cookie and carry a valid signature.
+func VerifyCSRF(c *gin.Context) bool {
+	cookie, err := c.Cookie(CSRFCookieName)
+	if err != nil || cookie == "" {
+		return false
+	}
+	header := c.GetHeader(CSRFHeaderName)
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		return false
+	}
+
+	parts := strings.SplitN(cookie, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	return hmac.Equal([]byte(parts[1]), []byte(signCSRFNonce(parts[0])))
+}
@@ -0,0 +1,99 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceCookieName names the long lived cookie that marks a browser its user has signed in
+// from before. Failed logins from such a device don't count towards a lockout, so an
+// attacker can't lock a user out of the devices they already use.
+var DeviceCookieName = GetEnv("AUTH_DEVICE_COOKIE_NAME", "device")
+
+// DeviceTokenTTL is how long a device is remembered after its last login, set with DEVICE_TOKEN_TTL.
+var DeviceTokenTTL = GetEnvDuration("DEVICE_TOKEN_TTL", 180*24*time.Hour)
+
+// NewDeviceId returns a random id for a device that hasn't been seen before.
+func NewDeviceId() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
+
+// DeviceToken returns the device token of deviceId for userId: the id and its HMAC under
+// SECRET_KEY, bound to the user.
+func DeviceToken(userId string, deviceId string) string {
+	return deviceId + "." + signDeviceId(userId, deviceId)
+}
+
+// GenerateDeviceToken returns a device token for userId with a new device id.
+func GenerateDeviceToken(userId string) (string, error) {
+	deviceId, err := NewDeviceId()
+	if err != nil {
+		return "", err
+	}
+	return DeviceToken(userId, deviceId), nil
+}
+
+// VerifyDeviceToken returns the device id of token if it was issued to userId.
+func VerifyDeviceToken(token string, userId string) (deviceId string, ok bool) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(signDeviceId(userId, parts[0]))) {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// RenewDeviceToken returns token when it already belongs to userId, or else a new one.
+func RenewDeviceToken(token string, userId string) (string, error) {
+	if _, ok := VerifyDeviceToken(token, userId); ok {
+		return token, nil
+	}
+	return GenerateDeviceToken(userId)
+}
+
+func signDeviceId(userId string, deviceId string) string {
+	mac := hmac.New(sha256.New, []byte(SECRET_KEY))
+	mac.Write([]byte("device:" + userId + ":" + deviceId))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DeviceFingerprint describes a client by its user agent and the network it connects from,
+// so a new address from the same provider still matches. Both are up to the client, so a
+// fingerprint only makes a login look familiar; it never stands in for a device token.
+func DeviceFingerprint(userAgent string, ip string) string {
+	sum := sha256.Sum256([]byte(userAgent + "\n" + IPPrefix(ip)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// IPPrefix returns the /24 network of an IPv4 address or the /48 network of an IPv6
+// address, or ip itself when it can't be parsed.
+func IPPrefix(ip string) string {
+	address := net.ParseIP(ip)
+	if address == nil {
+		return ip
+	}
+	if v4 := address.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return address.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// SetDeviceCookie stores token in the HttpOnly device cookie, which is only sent to /users
+// where the login endpoint lives.
+func SetDeviceCookie(c *gin.Context, token string) {
+	setCookie(c, DeviceCookieName, token, RefreshCookiePath, int(DeviceTokenTTL/time.Second), true)
+}
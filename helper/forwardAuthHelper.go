@@ -0,0 +1,126 @@
+package helper
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ForwardAuthRule decides who may reach a host and path behind the reverse proxy.
+// Host may start with "*." to match any subdomain; an empty Host or Path_prefix matches
+// everything. Public rules let anonymous requests through and an empty User_types list
+// admits any authenticated user.
+type ForwardAuthRule struct {
+	Host        string   `json:"host"`
+	Path_prefix string   `json:"path_prefix"`
+	User_types  []string `json:"user_types"`
+	Public      bool     `json:"public"`
+}
+
+// forwardAuthRules are loaded once from the JSON file named by FORWARD_AUTH_RULES_FILE and
+// are checked in order; the first match wins.
+var forwardAuthRules = loadForwardAuthRules(GetEnv("FORWARD_AUTH_RULES_FILE", ""))
+
+func loadForwardAuthRules(path string) []ForwardAuthRule {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal("Error loading forward auth rules: ", err)
+	}
+	var rules []ForwardAuthRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		log.Fatal("Error parsing forward auth rules: ", err)
+	}
+	return rules
+}
+
+// MatchForwardAuthRule returns the first rule matching host and path. Requests that match
+// no rule need an authenticated user of any type.
+func MatchForwardAuthRule(host string, path string) ForwardAuthRule {
+	host = strings.ToLower(strings.Split(host, ":")[0])
+	for _, rule := range forwardAuthRules {
+		if !matchHost(strings.ToLower(rule.Host), host) {
+			continue
+		}
+		if strings.HasPrefix(path, rule.Path_prefix) {
+			return rule
+		}
+	}
+	return ForwardAuthRule{}
+}
+
+func matchHost(pattern string, host string) bool {
+	if pattern == "" || pattern == host {
+		return true
+	}
+	return strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])
+}
+
+// AllowsUserType reports whether the rule admits users of the given type.
+func (rule ForwardAuthRule) AllowsUserType(userType string) bool {
+	if len(rule.User_types) == 0 {
+		return true
+	}
+	for _, allowed := range rule.User_types {
+		if allowed == userType {
+			return true
+		}
+	}
+	return false
+}
+
+// DecisionCache remembers forward auth decisions for a short time so a page that loads
+// dozens of assets doesn't validate the same token against the database for each one.
+type DecisionCache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]cachedDecision
+	lastSweep time.Time
+}
+
+type cachedDecision struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewDecisionCache creates a cache whose entries live for ttl. A ttl of zero disables caching.
+func NewDecisionCache(ttl time.Duration) *DecisionCache {
+	return &DecisionCache{ttl: ttl, entries: map[string]cachedDecision{}}
+}
+
+// Get returns the cached value for key if it hasn't expired.
+func (cache *DecisionCache) Get(key string) (interface{}, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, found := cache.entries[key]
+	if !found || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Set stores value under key. Expired entries are swept out at most once per ttl.
+func (cache *DecisionCache) Set(key string, value interface{}) {
+	if cache.ttl <= 0 {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(cache.lastSweep) > cache.ttl {
+		for k, entry := range cache.entries {
+			if now.After(entry.expires) {
+				delete(cache.entries, k)
+			}
+		}
+		cache.lastSweep = now
+	}
+	cache.entries[key] = cachedDecision{value: value, expires: now.Add(cache.ttl)}
+}
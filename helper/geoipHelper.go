@@ -0,0 +1,83 @@
+package helper
+
+import (
+	"log"
+	"math"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoIPDatabase is the path of a local MaxMind DB file with city locations, such as
+// GeoLite2-City.mmdb, set with GEOIP_DATABASE. Without it logins aren't located and
+// impossible travel can't be detected.
+var GeoIPDatabase = GetEnv("GEOIP_DATABASE", "")
+
+var geoIPReader = openGeoIPDatabase()
+
+func openGeoIPDatabase() *maxminddb.Reader {
+	if GeoIPDatabase == "" {
+		return nil
+	}
+	reader, err := maxminddb.Open(GeoIPDatabase)
+	if err != nil {
+		log.Fatal("error occurred while opening GEOIP_DATABASE: ", err)
+	}
+	return reader
+}
+
+// Location is where an IP address is, as far as the GeoIP database knows.
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+// geoIPRecord holds the fields of a GeoLite2 or GeoIP2 City record that are looked at.
+type geoIPRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// LookupLocation returns where ip is. It reports false when there is no GeoIP database or
+// the database doesn't place the address, as for private networks.
+func LookupLocation(ip string) (Location, bool) {
+	address := net.ParseIP(ip)
+	if geoIPReader == nil || address == nil {
+		return Location{}, false
+	}
+	var record geoIPRecord
+	if err := geoIPReader.Lookup(address, &record); err != nil {
+		log.Println("error occurred while looking up an IP address:", err)
+		return Location{}, false
+	}
+	if record.Location.Latitude == nil || record.Location.Longitude == nil {
+		return Location{}, false
+	}
+	return Location{
+		Country:   record.Country.IsoCode,
+		City:      record.City.Names["en"],
+		Latitude:  *record.Location.Latitude,
+		Longitude: *record.Location.Longitude,
+	}, true
+}
+
+// DistanceKm returns the great-circle distance between two points in kilometers.
+func DistanceKm(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
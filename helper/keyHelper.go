@@ -0,0 +1,316 @@
+package helper
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SigningKeyRetention is how long a rotated out key stays published. It outlives the
+// 7 day refresh token so every token a key signed can still be verified.
+const SigningKeyRetention = 8 * 24 * time.Hour
+
+// signingKeyReload is how often keys are re-read, so a rotation made by another instance
+// or by authctl is picked up without a restart. A token with an unknown kid forces a
+// reload at most once per signingKeyMinRefetch, so forged kids can't flood the database.
+const (
+	signingKeyReload     = time.Minute
+	signingKeyMinRefetch = 10 * time.Second
+)
+
+var signingKeyCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "signing_key")
+
+type loadedKey struct {
+	kid        string
+	privateKey *rsa.PrivateKey
+}
+
+var keyStore = struct {
+	sync.RWMutex
+	active      *loadedKey
+	keys        map[string]*loadedKey
+	loadedAt    time.Time
+	refetchedAt time.Time
+}{}
+
+// JSONWebKey is the public half of a signing key in RFC 7517 form.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// loadSigningKeys reads the active and recently rotated keys from the database, creating
+// the first key when there is none yet.
+func loadSigningKeys() error {
+	active, keys, err := readSigningKeys()
+	if err != nil {
+		return err
+	}
+	if active == nil {
+		if _, err = RotateSigningKey(); err != nil {
+			return err
+		}
+		if active, keys, err = readSigningKeys(); err != nil {
+			return err
+		}
+		if active == nil {
+			return errors.New("no active signing key")
+		}
+	}
+
+	keyStore.Lock()
+	keyStore.active, keyStore.keys, keyStore.loadedAt = active, keys, time.Now()
+	keyStore.Unlock()
+	return nil
+}
+
+func readSigningKeys() (*loadedKey, map[string]*loadedKey, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	filter := bson.M{"$or": []bson.M{
+		{"active": true},
+		{"deactivated_at": bson.M{"$gt": time.Now().Add(-SigningKeyRetention)}},
+	}}
+	cursor, err := signingKeyCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, nil, err
+	}
+	var stored []models.SigningKey
+	if err = cursor.All(ctx, &stored); err != nil {
+		return nil, nil, err
+	}
+
+	keys := map[string]*loadedKey{}
+	var active *loadedKey
+	for _, signingKey := range stored {
+		privateKey, err := openSigningKey(ctx, signingKey)
+		if err != nil {
+			log.Println("error occurred while reading signing key", signingKey.Kid+":", err)
+			continue
+		}
+		key := &loadedKey{kid: signingKey.Kid, privateKey: privateKey}
+		keys[key.kid] = key
+		// Keys are sorted newest first, so the newest active key wins if two were created at once
+		if signingKey.Active && active == nil {
+			active = key
+		}
+	}
+	return active, keys, nil
+}
+
+// currentKeys returns the loaded keys, reloading them when they are older than signingKeyReload.
+func currentKeys(forceReload bool) (*loadedKey, map[string]*loadedKey, error) {
+	keyStore.RLock()
+	active, keys, loadedAt := keyStore.active, keyStore.keys, keyStore.loadedAt
+	keyStore.RUnlock()
+
+	if active == nil || forceReload || time.Since(loadedAt) > signingKeyReload {
+		if err := loadSigningKeys(); err != nil {
+			// Keep serving with the keys we have if the database hiccups
+			if active != nil {
+				return active, keys, nil
+			}
+			return nil, nil, err
+		}
+		keyStore.RLock()
+		active, keys = keyStore.active, keyStore.keys
+		keyStore.RUnlock()
+	}
+	return active, keys, nil
+}
+
+// RotateSigningKey generates a new RSA key, makes it the active signing key and deactivates
+// the previous one, which stays published for SigningKeyRetention.
+func RotateSigningKey() (models.SigningKey, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	// The private key is sealed so a copy of the database alone can't be used to mint tokens
+	sealed, err := SealSecret(string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})))
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	signingKey := models.SigningKey{
+		ID:          primitive.NewObjectID(),
+		Algorithm:   "RS256",
+		Private_key: sealed,
+		Active:      true,
+		Created_at:  now,
+	}
+	signingKey.Kid = signingKey.ID.Hex()
+
+	if _, err = signingKeyCollection.InsertOne(ctx, signingKey); err != nil {
+		return models.SigningKey{}, err
+	}
+	_, err = signingKeyCollection.UpdateMany(ctx,
+		bson.M{"active": true, "kid": bson.M{"$ne": signingKey.Kid}},
+		bson.M{"$set": bson.M{"active": false, "deactivated_at": now}},
+	)
+	return signingKey, err
+}
+
+// SignClaims signs claims with the active signing key and records its kid in the header.
+func SignClaims(claims jwt.Claims) (string, error) {
+	active, _, err := currentKeys(false)
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = active.kid
+	return token.SignedString(active.privateKey)
+}
+
+// VerificationKey returns the public key for kid. An unknown kid triggers a reload in case
+// the key was just created by another instance, at most once per signingKeyMinRefetch.
+func VerificationKey(kid string) (*rsa.PublicKey, error) {
+	_, keys, err := currentKeys(false)
+	if err != nil {
+		return nil, err
+	}
+	if key, found := keys[kid]; found {
+		return &key.privateKey.PublicKey, nil
+	}
+
+	keyStore.Lock()
+	refetch := time.Since(keyStore.refetchedAt) >= signingKeyMinRefetch
+	if refetch {
+		keyStore.refetchedAt = time.Now()
+	}
+	keyStore.Unlock()
+	if !refetch {
+		return nil, errors.New("unknown signing key")
+	}
+
+	_, keys, err = currentKeys(true)
+	if err != nil {
+		return nil, err
+	}
+	if key, found := keys[kid]; found {
+		return &key.privateKey.PublicKey, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// ExportSigningKeys returns the public half of every signing key ever created, rotated out
+// ones included. Operators keep the result outside the database, so verifying audit
+// checkpoints doesn't have to trust keys read from the database being checked.
+func ExportSigningKeys(ctx context.Context) ([]JSONWebKey, error) {
+	cursor, err := signingKeyCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var stored []models.SigningKey
+	if err = cursor.All(ctx, &stored); err != nil {
+		return nil, err
+	}
+
+	jwks := []JSONWebKey{}
+	for _, signingKey := range stored {
+		privateKey, err := openSigningKey(ctx, signingKey)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", signingKey.Kid, err)
+		}
+		jwks = append(jwks, publicJSONWebKey(signingKey.Kid, &privateKey.PublicKey))
+	}
+	return jwks, nil
+}
+
+// ParseJWKS reads the RSA keys of a JSON Web Key Set, such as one written by
+// ExportSigningKeys, indexed by kid.
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if key.Kty != "RSA" || errN != nil || errE != nil {
+			return nil, fmt.Errorf("key %s is not a valid RSA key", key.Kid)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// openSigningKey unseals and parses the private key of signingKey. Keys stored before they
+// were sealed hold a plain PEM; they are sealed in place the first time they are read.
+func openSigningKey(ctx context.Context, signingKey models.SigningKey) (*rsa.PrivateKey, error) {
+	keyPEM := signingKey.Private_key
+	if strings.HasPrefix(keyPEM, "-----BEGIN") {
+		if sealed, err := SealSecret(keyPEM); err == nil {
+			signingKeyCollection.UpdateOne(ctx, bson.M{"_id": signingKey.ID, "private_key": keyPEM}, bson.M{"$set": bson.M{"private_key": sealed}})
+		}
+	} else {
+		opened, err := OpenSecret(keyPEM)
+		if err != nil {
+			return nil, errors.New("the signing key can't be unsealed; check SECRET_KEY")
+		}
+		keyPEM = opened
+	}
+
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("invalid signing key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// PublicJWKS returns the public keys that may have signed a currently valid token.
+func PublicJWKS() ([]JSONWebKey, error) {
+	_, keys, err := currentKeys(false)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := []JSONWebKey{}
+	for kid, key := range keys {
+		jwks = append(jwks, publicJSONWebKey(kid, &key.privateKey.PublicKey))
+	}
+	return jwks, nil
+}
+
+func publicJSONWebKey(kid string, publicKey *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+	}
+}
@@ -0,0 +1,60 @@
+package helper
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// SMTP settings for the notification emails. Without SMTP_ADDR (host:port) emails can't be
+// sent and only their recipient and subject are logged; their bodies hold reset links and
+// login codes, so they are only logged as well when MAIL_LOG_BODY is set for development.
+var (
+	smtpAddr     = GetEnv("SMTP_ADDR", "")
+	smtpFrom     = GetEnv("SMTP_FROM", "no-reply@localhost")
+	smtpUsername = GetEnv("SMTP_USERNAME", "")
+	smtpPassword = GetEnv("SMTP_PASSWORD", "")
+	mailLogBody  = GetEnvBool("MAIL_LOG_BODY", false)
+)
+
+// SendMail sends a plain text email to a single recipient.
+func SendMail(to string, subject string, body string) error {
+	// Keep line breaks out of the headers so nothing can be injected into them
+	to = strings.NewReplacer("\r", "", "\n", "").Replace(to)
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	if smtpAddr == "" {
+		if mailLogBody {
+			log.Printf("email to %s: %s\n%s", to, subject, body)
+			return nil
+		}
+		return errors.New("SMTP_ADDR is not set; the email " + strconv.Quote(subject) + " wasn't sent")
+	}
+
+	message := "From: " + smtpFrom + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+
+	var auth smtp.Auth
+	if smtpUsername != "" {
+		host, _, _ := net.SplitHostPort(smtpAddr)
+		auth = smtp.PlainAuth("", smtpUsername, smtpPassword, host)
+	}
+	return smtp.SendMail(smtpAddr, auth, smtpFrom, []string{to}, []byte(message))
+}
+
+// SendMailAsync sends an email in the background, logging a failure, so a slow mail server
+// never holds up a request.
+func SendMailAsync(to string, subject string, body string) {
+	go func() {
+		if err := SendMail(to, subject, body); err != nil {
+			log.Println("error occurred while sending an email to", to+":", err)
+		}
+	}()
+}
@@ -0,0 +1,50 @@
+package helper
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oauthClients holds the client credentials allowed to call the introspection and
+// revocation endpoints, configured as OAUTH_CLIENTS="gateway:secret,legacy:secret2".
+var oauthClients = parseOAuthClients(GetEnv("OAUTH_CLIENTS", ""))
+
+func parseOAuthClients(value string) map[string]string {
+	clients := map[string]string{}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			clients[parts[0]] = parts[1]
+		}
+	}
+	return clients
+}
+
+// AuthenticateClient checks the client credentials of an OAuth request, sent either with
+// HTTP Basic authentication or as client_id/client_secret form fields.
+func AuthenticateClient(c *gin.Context) (clientId string, ok bool) {
+	clientId, clientSecret, hasBasic := c.Request.BasicAuth()
+	if !hasBasic {
+		clientId = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+
+	expected, found := oauthClients[clientId]
+	if !found || clientId == "" {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(clientSecret), []byte(expected)) != 1 {
+		return "", false
+	}
+	return clientId, true
+}
+
+// AbortInvalidClient ends an OAuth request whose client failed to authenticate, as
+// described in RFC 6749 section 5.2.
+func AbortInvalidClient(c *gin.Context) {
+	c.Header("WWW-Authenticate", `Basic realm="`+AuthRealm+`"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+}
@@ -0,0 +1,59 @@
+package helper
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthRealm is the realm advertised in WWW-Authenticate challenges.
+var AuthRealm = GetEnv("AUTH_REALM", "api")
+
+// BearerChallenge builds an RFC 6750 WWW-Authenticate value for the Bearer scheme.
+func BearerChallenge(params ...string) string {
+	challenge := []string{fmt.Sprintf("realm=%q", AuthRealm)}
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			challenge = append(challenge, fmt.Sprintf("%s=%q", params[i], params[i+1]))
+		}
+	}
+	return "Bearer " + strings.Join(challenge, ", ")
+}
+
+// AbortUnauthorized ends the request with 401 and a Bearer challenge.
+// errorCode is an RFC 6750 error code such as "invalid_token"; it is left out of the
+// challenge when empty, which is what the RFC asks for when no credentials were sent.
+func AbortUnauthorized(c *gin.Context, errorCode string, description string) {
+	c.Header("WWW-Authenticate", BearerChallenge("error", errorCode, "error_description", description))
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": description})
+}
+
+// AbortInsufficientScope ends the request with 403 and an insufficient_scope challenge
+// naming the scope the caller is missing.
+func AbortInsufficientScope(c *gin.Context, scope string, description string) {
+	c.Header("WWW-Authenticate", BearerChallenge("error", "insufficient_scope", "error_description", description, "scope", scope))
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": description})
+}
+
+// AbortForbidden ends the request with 403 for an authenticated caller that isn't allowed
+// to access the resource.
+func AbortForbidden(c *gin.Context, description string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": description})
+}
+
+// AbortInsufficientUserAuthentication ends the request with 401 and the
+// insufficient_user_authentication challenge of RFC 9470, telling the client how recently
+// and, when methods are given, how the user has to have authenticated.
+func AbortInsufficientUserAuthentication(c *gin.Context, maxAge time.Duration, methods []string, description string) {
+	seconds := strconv.FormatInt(int64(maxAge/time.Second), 10)
+	c.Header("WWW-Authenticate", BearerChallenge("error", "insufficient_user_authentication", "error_description", description, "max_age", seconds))
+	response := gin.H{"error": description, "reauthentication_required": true, "max_age": int64(maxAge / time.Second)}
+	if len(methods) > 0 {
+		response["methods"] = methods
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, response)
+}
@@ -0,0 +1,189 @@
+package helper
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SessionLifetime matches the refresh token lifetime; every refresh slides it forward.
+const SessionLifetime = 168 * time.Hour
+
+var sessionCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "session")
+
+// Authentication methods recorded in the amr claim (RFC 8176). An emailed code has no
+// registered name, so it is recorded as AmrEmail.
+const (
+	AmrPassword = "pwd"
+	AmrOTP      = "otp"
+	AmrMFA      = "mfa"
+	AmrEmail    = "email"
+)
+
+// CreateSession records a new login for userId from the given user agent and IP address,
+// authenticated with the methods in amr.
+func CreateSession(userId string, userAgent string, ip string, amr []string) (session models.Session, err error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	session = models.Session{
+		ID:           primitive.NewObjectID(),
+		User_id:      userId,
+		Device:       DeviceName(userAgent),
+		User_agent:   userAgent,
+		Ip:           ip,
+		Created_at:   now,
+		Last_used_at: now,
+		Expires_at:   now.Add(SessionLifetime),
+		Auth_time:    now,
+		Amr:          amr,
+	}
+	session.Session_id = session.ID.Hex()
+
+	_, err = sessionCollection.InsertOne(ctx, session)
+	return session, err
+}
+
+// ReauthenticateSession records that the user of an active session proved who they are
+// again just now, with the methods in amr, and returns the updated session.
+func ReauthenticateSession(sessionId string, userId string, amr []string) (session models.Session, msg string) {
+	if session, msg = ValidateSession(sessionId, userId); msg != "" {
+		return session, msg
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err := sessionCollection.UpdateOne(ctx, bson.M{"session_id": sessionId}, bson.M{"$set": bson.M{"auth_time": now, "amr": amr}})
+	if err != nil {
+		return session, "error occurred while updating the session"
+	}
+	session.Auth_time, session.Amr = now, amr
+	return session, ""
+}
+
+// CreateImpersonationSession records a session for actorId acting as userId. It expires
+// after ttl and never gets a refresh token.
+func CreateImpersonationSession(userId string, actorId string, userAgent string, ip string, ttl time.Duration) (session models.Session, err error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	session = models.Session{
+		ID:              primitive.NewObjectID(),
+		User_id:         userId,
+		Device:          "Impersonation: " + DeviceName(userAgent),
+		User_agent:      userAgent,
+		Ip:              ip,
+		Created_at:      now,
+		Last_used_at:    now,
+		Expires_at:      now.Add(ttl),
+		Impersonator_id: actorId,
+	}
+	session.Session_id = session.ID.Hex()
+
+	_, err = sessionCollection.InsertOne(ctx, session)
+	return session, err
+}
+
+// UpdateSessionTokens stores the hash of a newly issued refresh token on the session and
+// extends its expiry, so only the latest refresh token of the session is accepted.
+func UpdateSessionTokens(sessionId string, signedRefreshToken string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	_, err := sessionCollection.UpdateOne(ctx, bson.M{"session_id": sessionId}, bson.M{"$set": bson.M{
+		"refresh_token_hash": HashToken(signedRefreshToken),
+		"last_used_at":       now,
+		"expires_at":         now.Add(SessionLifetime),
+	}})
+	return err
+}
+
+// ValidateSession checks that a session is still active and belongs to userId.
+// It also bumps last_used_at, at most once a minute to keep writes cheap.
+func ValidateSession(sessionId string, userId string) (session models.Session, msg string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	err := sessionCollection.FindOne(ctx, bson.M{"session_id": sessionId, "user_id": userId}).Decode(&session)
+	if err != nil {
+		msg = "the session does not exist"
+		return
+	}
+	if session.Revoked_at != nil {
+		msg = "the session has been signed out"
+		return
+	}
+	if session.Expires_at.Before(time.Now()) {
+		msg = "the session is expired"
+		return
+	}
+
+	now := time.Now()
+	if session.Last_used_at.Before(now.Add(-time.Minute)) {
+		sessionCollection.UpdateOne(ctx, bson.M{"session_id": sessionId}, bson.M{"$set": bson.M{"last_used_at": now}})
+	}
+	return session, msg
+}
+
+// CheckSessionRefreshToken reports whether signedRefreshToken is the latest refresh token
+// issued for the session.
+func CheckSessionRefreshToken(session models.Session, signedRefreshToken string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(signedRefreshToken)), []byte(session.Refresh_token_hash)) == 1
+}
+
+// RevokeSessions signs out the sessions of userId matched by filter and returns how many were revoked.
+func RevokeSessions(userId string, filter bson.M) (int64, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter["user_id"] = userId
+	filter["revoked_at"] = nil
+
+	revokedAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := sessionCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": revokedAt}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// DeviceName turns a user agent into a short label such as "Firefox on Linux".
+func DeviceName(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"},
+		{"Windows", "Windows"}, {"Mac OS X", "macOS"}, {"Linux", "Linux"},
+	}
+
+	browser := "Unknown browser"
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			return browser + " on " + s.name
+		}
+	}
+	return browser
+}
@@ -0,0 +1,47 @@
+package helper
+
+// ResolveToken validates any credential this service issues and returns its claims.
+// Personal API keys are checked against their stored hash, access tokens against their
+// session, and refresh tokens against both their session and the latest refresh token
+// issued for it. The owner must still be active in every case. Callers that only accept
+// one kind of token must check Token_type.
+func ResolveToken(token string) (claims *SignedDetails, msg string) {
+	if IsAPIKey(token) {
+		return ValidateAPIKey(token)
+	}
+
+	claims, msg = ValidateToken(token)
+	if msg != "" {
+		return nil, msg
+	}
+
+	switch claims.Token_type {
+	case AccessToken:
+		if _, msg = ValidateSession(claims.Session_id, claims.Uid); msg != "" {
+			return nil, msg
+		}
+	case RefreshToken:
+		session, msg := ValidateSession(claims.Session_id, claims.Uid)
+		if msg != "" {
+			return nil, msg
+		}
+		if !CheckSessionRefreshToken(session, token) {
+			return nil, "the refresh token has already been used"
+		}
+	default:
+		return nil, "the token is invalid"
+	}
+
+	// Suspended, locked and deleted users lose access even if a session survived
+	if msg = CheckActiveUser(claims.Uid); msg != "" {
+		return nil, msg
+	}
+	// An impersonation ends as soon as the acting ADMIN loses access
+	if claims.Act != nil {
+		if msg = CheckActiveUser(claims.Act.Sub); msg != "" {
+			return nil, "the impersonating user is no longer active"
+		}
+	}
+
+	return claims, ""
+}
@@ -0,0 +1,129 @@
+package helper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// TOTP parameters, the ones every authenticator app supports: SHA-1, 6 digits, 30 seconds.
+// A code from the step before or after the current one is still accepted to allow for
+// clock drift.
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	totpSkew   = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPIssuer names the service in authenticator apps, set with TOTP_ISSUER. It defaults to
+// JWT_ISSUER.
+var TOTPIssuer = GetEnv("TOTP_ISSUER", GetEnv("JWT_ISSUER", "GO_JWT_Authentication"))
+
+// GenerateTOTPSecret returns a new random TOTP secret, base32 encoded for authenticator apps.
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI returns the otpauth URI of secret for account, which authenticator apps read
+// from a QR code.
+func TOTPURI(account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", TOTPIssuer)
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(TOTPIssuer+":"+account) + "?" + query.Encode()
+}
+
+// ValidateTOTP checks code against secret at now and returns the time step it belongs to,
+// so callers can refuse a code that was already used.
+func ValidateTOTP(secret string, code string, now time.Time) (step int64, ok bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step = current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the code of key for a time step as described in RFC 6238.
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// secretKey derives the key that seals secrets stored in the database, like TOTP secrets,
+// from SECRET_KEY.
+func secretKey() []byte {
+	sum := sha256.Sum256([]byte("secret-seal:" + SECRET_KEY))
+	return sum[:]
+}
+
+// SealSecret encrypts value with AES-GCM so a copy of the database alone doesn't reveal it.
+func SealSecret(value string) (string, error) {
+	block, err := aes.NewCipher(secretKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+// OpenSecret decrypts a value sealed with SealSecret.
+func OpenSecret(sealed string) (string, error) {
+	data, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(secretKey())
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("the sealed secret is too short")
+	}
+	value, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"context"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CheckUserStatus returns why user may not authenticate, or an empty string when they may.
+func CheckUserStatus(user models.User) (msg string) {
+	if user.Locked_at != nil {
+		return "this account is locked"
+	}
+	switch user.CurrentStatus() {
+	case models.UserActive:
+		return ""
+	case models.UserSuspended:
+		return "this account is suspended"
+	case models.UserPending:
+		return "this account is pending approval"
+	case models.UserDeleted:
+		return "this account has been deleted"
+	}
+	return "this account is not active"
+}
+
+// CheckActiveUser loads userId and checks that they may still authenticate. Tokens are
+// usually cut off by signing out their sessions when a user is suspended, but this also
+// catches status changes made straight in the database.
+func CheckActiveUser(userId string) (msg string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	var user models.User
+	opts := options.FindOne().SetProjection(bson.M{"status": 1, "locked_at": 1})
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}, opts).Decode(&user); err != nil {
+		return "the user no longer exists"
+	}
+	return CheckUserStatus(user)
+}
@@ -1,9 +1,20 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/docs"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/extauthz"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/grpcserver"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
 	routes "github.com/Danitilahun/GO_JWT_Authentication.git/route"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
 	"github.com/gin-gonic/gin"
-	"os"
 )
 
 func main() {
@@ -17,6 +28,19 @@ func main() {
 	//  features like routing, middleware support, JSON handling, and graceful error management.
 	router := gin.New()
 
+	// only take the client address from X-Forwarded-For when the request came through one of
+	// the proxies in TRUSTED_PROXIES (comma separated addresses or CIDRs). By default none is
+	// trusted, so clients can't choose the address rate limits, lockouts and device checks see
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("invalid TRUSTED_PROXIES: ", err)
+	}
+
 	// use the default gin middleware for logging and recovery
 	router.Use(gin.Logger())
 
@@ -32,8 +56,23 @@ func main() {
 
 	router.Use(gin.Recovery())
 
+	// reject requests that don't match the OpenAPI document when OPENAPI_VALIDATE is set
+	if middleware.ValidateRequests {
+		router.Use(middleware.ValidateOpenAPI())
+	}
+
 	routes.UserRoutes(router)
 	routes.AuthRoutes(router)
+	routes.APIKeyRoutes(router)
+	routes.SessionRoutes(router)
+	routes.OAuthRoutes(router)
+	routes.ForwardAuthRoutes(router)
+	routes.JWKSRoutes(router)
+	routes.OpenAPIRoutes(router)
+	routes.AuditRoutes(router)
+	routes.PasswordRoutes(router)
+	routes.DeviceRoutes(router)
+	routes.EmailRoutes(router)
 
 	// define a simple route for testing
 	router.GET("/", func(c *gin.Context) {
@@ -42,6 +81,39 @@ func main() {
 		})
 	})
 
+	// make sure every route is described in the OpenAPI document and vice versa;
+	// OPENAPI_STRICT turns drift into a startup failure
+	drift, err := docs.CheckRoutes(router.Routes())
+	if err != nil {
+		log.Fatal("invalid OpenAPI document: ", err)
+	}
+	for _, difference := range drift {
+		log.Println("OpenAPI drift,", difference)
+	}
+	if len(drift) > 0 && helper.GetEnvBool("OPENAPI_STRICT", false) {
+		log.Fatal("the OpenAPI document is out of sync with the routes")
+	}
+
+	// permanently remove soft-deleted users once their retention period has passed
+	go service.RunPurge(context.Background(), helper.GetEnvDuration("PURGE_INTERVAL", time.Hour))
+
+	// periodically sign the head of the audit hash chain so truncation and rewrites can be detected
+	go helper.RunAuditCheckpoints(context.Background(), helper.GetEnvDuration("AUDIT_CHECKPOINT_INTERVAL", time.Hour))
+
+	// start the Envoy ext_authz gRPC listener when an address is configured
+	if extAuthzAddr := os.Getenv("EXT_AUTHZ_ADDR"); extAuthzAddr != "" {
+		go func() {
+			log.Fatal(extauthz.ListenAndServe(extAuthzAddr))
+		}()
+	}
+
+	// start the gRPC API alongside the HTTP router when an address is configured
+	if grpcAddr := os.Getenv("GRPC_ADDR"); grpcAddr != "" {
+		go func() {
+			log.Fatal(grpcserver.ListenAndServe(grpcAddr))
+		}()
+	}
+
 	// start the server on port 8080
 	router.Run(":" + port)
 }
@@ -4,49 +4,152 @@ import (
 	"github.com/Danitilahun/GO_JWT_Authentication.git/helper"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func getTokenFromHeader(c *gin.Context) string {
-	// Extract token from the request header
-	clientToken := c.Request.Header.Get("token")
+// RecentAuthMaxAge is how recently a user must have signed in or reauthenticated for the
+// routes guarded by RequireRecentAuth, set with REAUTH_MAX_AGE.
+var RecentAuthMaxAge = helper.GetEnvDuration("REAUTH_MAX_AGE", 10*time.Minute)
 
-	// Check if the token is empty
+// AllowLegacyTokenHeader keeps the old non-standard "token" header working for existing clients.
+var AllowLegacyTokenHeader = helper.GetEnvBool("AUTH_LEGACY_TOKEN_HEADER", true)
+
+// ExtractToken returns the credential sent with the request and where it was found.
+// It looks at, in order, the standard "Authorization: Bearer" header, the auth cookie
+// and the legacy "token" header. An empty token means no credentials were sent.
+func ExtractToken(c *gin.Context) (token string, source string) {
+	// Extract token from the standard Authorization header
+	authHeader := c.Request.Header.Get("Authorization")
+	if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
+		return strings.TrimSpace(authHeader[7:]), "header"
+	}
+
+	// Fall back to the access token cookie set in browser mode
+	if cookie, err := c.Cookie(helper.AccessTokenCookieName); err == nil && cookie != "" {
+		return cookie, "cookie"
+	}
+
+	// Finally accept the legacy header if it is still enabled
+	if AllowLegacyTokenHeader {
+		if clientToken := c.Request.Header.Get("token"); clientToken != "" {
+			return clientToken, "legacy_header"
+		}
+	}
+
+	return "", ""
+}
+
+// AuthError describes why a request could not be authenticated.
+type AuthError struct {
+	Status      int    // 401 for missing or bad credentials, 403 for a failed CSRF check
+	Code        string // RFC 6750 error code, empty when no credentials were sent
+	Description string
+}
+
+// Abort ends the request with the status and challenge described by the error.
+func (e *AuthError) Abort(c *gin.Context) {
+	if e.Status == http.StatusForbidden {
+		helper.AbortForbidden(c, e.Description)
+		return
+	}
+	helper.AbortUnauthorized(c, e.Code, e.Description)
+}
+
+// VerifyRequest authenticates the request the same way Authenticate does without writing
+// a response. method is the HTTP method used for the CSRF check; it differs from the
+// request's own method when verifying on behalf of a reverse proxy.
+func VerifyRequest(c *gin.Context, method string) (*helper.SignedDetails, *AuthError) {
+	// Extract token from the request
+	clientToken, source := ExtractToken(c)
+
+	// Check if the token is empty; RFC 6750 asks for a bare challenge in that case
 	if clientToken == "" {
-		// Respond with an error indicating missing authorization header
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "No Authorization header provided"})
+		return nil, &AuthError{http.StatusUnauthorized, "", "No Authorization header provided"}
+	}
 
-		// Abort further processing
-		c.Abort()
-		return ""
+	// Validate the access token or personal API key
+	claims, err := helper.ResolveToken(clientToken)
+	if err == "" && claims.Token_type == helper.RefreshToken {
+		err = "the token is not an access token"
+	}
+	if err != "" {
+		return nil, &AuthError{http.StatusUnauthorized, "invalid_token", err}
 	}
 
-	return clientToken
+	// Cookies are sent by the browser automatically, so state-changing requests
+	// authenticated by cookie must also prove they came from our own frontend
+	if source == "cookie" && !helper.IsSafeMethod(method) && !helper.VerifyCSRF(c) {
+		return nil, &AuthError{http.StatusForbidden, "", "missing or invalid CSRF token"}
+	}
+
+	return claims, nil
+}
+
+// setClaims stores the authenticated identity in the gin context for the handlers.
+func setClaims(c *gin.Context, claims *helper.SignedDetails) {
+	if claims.Token_type == helper.APIKeyToken {
+		c.Set("auth_method", "api_key")
+	} else {
+		c.Set("auth_method", "jwt")
+	}
+	c.Set("email", claims.Email)
+	c.Set("first_name", claims.First_name)
+	c.Set("last_name", claims.Last_name)
+	c.Set("uid", claims.Uid)
+	c.Set("user_type", claims.User_type)
+	c.Set("scopes", claims.Scopes)
+	c.Set("session_id", claims.Session_id)
+	if claims.Auth_time != 0 {
+		c.Set("auth_time", strconv.FormatInt(claims.Auth_time, 10))
+	}
+	c.Set("amr", claims.Amr)
+	if claims.Act != nil {
+		c.Set("act_sub", claims.Act.Sub)
+	}
 }
 
 func Authenticate() gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 
-		// Extract token from the request header
-		clientToken := getTokenFromHeader(c)
-
-		// Validate the token
-		claims, err := helper.ValidateToken(clientToken)
-
-		// Check if there was an error validating the token
-		if err != "" {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-			c.Abort()
+		// Validate the credentials sent with the request
+		claims, err := VerifyRequest(c, c.Request.Method)
+		if err != nil {
+			err.Abort(c)
 			return
 		}
 
 		// Set the claims in the context
-		c.Set("email", claims.Email)
-		c.Set("first_name", claims.First_name)
-		c.Set("last_name", claims.Last_name)
-		c.Set("uid", claims.Uid)
-		c.Set("user_type", claims.User_type)
+		setClaims(c, claims)
+
+		c.Next()
+	}
+}
 
+// BlockImpersonation rejects requests made with an impersonation token. Put it in front of
+// sensitive routes such as credential changes that an ADMIN must not take for the user.
+func BlockImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckNotImpersonating(c); err != nil {
+			helper.AbortForbidden(c, err.Error())
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRecentAuth rejects requests whose user hasn't proved who they are within maxAge,
+// or with one of methods when any are given, using the auth_time and amr claims. Put it
+// behind Authenticate on sensitive routes; rejected clients reauthenticate at
+// POST /users/me/reauthenticate and retry with the new token.
+func RequireRecentAuth(maxAge time.Duration, methods ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := helper.CheckRecentAuth(c, maxAge, methods); err != nil {
+			helper.AbortInsufficientUserAuthentication(c, maxAge, methods, err.Error())
+			return
+		}
 		c.Next()
 	}
 }
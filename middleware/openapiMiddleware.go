@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/docs"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+// ValidateRequests is enabled by OPENAPI_VALIDATE and makes ValidateOpenAPI reject requests
+// that don't match the published OpenAPI document.
+var ValidateRequests = helper.GetEnvBool("OPENAPI_VALIDATE", false)
+
+// ValidateOpenAPI checks the parameters and body of every documented request against
+// docs.OpenAPI and answers 400 with the first problem found. Requests for paths that aren't
+// in the document are passed through, and authentication is left to Authenticate.
+func ValidateOpenAPI() gin.HandlerFunc {
+	spec, err := docs.Spec()
+	if err != nil {
+		panic("invalid OpenAPI document: " + err.Error())
+	}
+	// Match on paths only; the document lists no servers so any host is accepted
+	spec.Servers = nil
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		panic("invalid OpenAPI document: " + err.Error())
+	}
+
+	// Report what is wrong with a value without echoing the whole schema back to the client
+	openapi3.SchemaErrorDetailsDisabled = true
+	options := &openapi3filter.Options{
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		MultiError:         false,
+	}
+
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if errors.Is(err, routers.ErrPathNotFound) || errors.Is(err, routers.ErrMethodNotAllowed) {
+			c.Next()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		}
+		// ValidateRequest restores the body afterwards so the handler can still bind it
+		if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// APIKey is a named, expiring and scoped credential that lets a user call the API
+// from scripts and CI jobs without storing their password. Only a SHA-256 hash of
+// the key is persisted; the Prefix is kept in clear text so a presented key can be
+// looked up without scanning the whole collection.
+type APIKey struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	Key_id       string             `json:"key_id"`
+	User_id      string             `json:"user_id"`
+	Name         *string            `json:"name" validate:"required,min=1,max=100"`
+	Prefix       string             `json:"prefix"`
+	Hashed_key   string             `json:"-"`
+	Scopes       []string           `json:"scopes"`
+	Expires_at   time.Time          `json:"expires_at"`
+	Created_at   time.Time          `json:"created_at"`
+	Last_used_at *time.Time         `json:"last_used_at"`
+	Revoked_at   *time.Time         `json:"revoked_at"`
+}
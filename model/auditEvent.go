@@ -0,0 +1,44 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// AuditEvent records a security relevant event, such as a login or a user's role being
+// changed, together with who caused it and from where. Outcome is "success" or "failure".
+// Events are only ever inserted, never updated or deleted.
+//
+// Each event is chained to the previous event of its Stream: Prev_hash is that event's
+// Hash, and Hash covers every other field, so altering or removing an event breaks the
+// chain from that point on.
+type AuditEvent struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Event_id   string             `json:"event_id"`
+	Action     string             `json:"action"`
+	Actor_id   string             `json:"actor_id"`
+	Target_id  string             `json:"target_id"`
+	Ip         string             `json:"ip,omitempty"`
+	User_agent string             `json:"user_agent,omitempty"`
+	Outcome    string             `json:"outcome"`
+	Details    map[string]string  `json:"details,omitempty"`
+	Created_at time.Time          `json:"created_at"`
+	Stream     string             `json:"stream"`
+	Sequence   int64              `json:"sequence"`
+	Prev_hash  string             `json:"prev_hash"`
+	Hash       string             `json:"hash"`
+}
+
+// AuditCheckpoint is a signed statement of the latest hash of an audit stream. Signature
+// is a JWT signed with the service's token signing key. The chain up to a checkpoint can
+// only be trusted as far as the key that verifies it: authctl audit-verify takes the public
+// keys from a file kept outside the database, since the database holds the sealed private
+// keys and anyone able to write to it could add a key of their own.
+type AuditCheckpoint struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Stream     string             `json:"stream"`
+	Sequence   int64              `json:"sequence"`
+	Hash       string             `json:"hash"`
+	Signature  string             `json:"signature"`
+	Created_at time.Time          `json:"created_at"`
+}
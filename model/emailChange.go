@@ -0,0 +1,27 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// EmailChange is a pending change of a user's email address. The new address gets a link
+// with the confirm token, which works until Expires_at, and the old address gets a link
+// with the undo token, which works until Undo_expires_at whether or not the change was
+// confirmed. Only hashes of both tokens are stored. Confirmed_at is set once the change
+// was made, Cancelled_at once it no longer can be, and Undone_at once the undo link was used.
+type EmailChange struct {
+	ID              primitive.ObjectID `bson:"_id"`
+	Token_hash      string             `json:"-"`
+	Undo_token_hash string             `json:"-"`
+	User_id         string             `json:"user_id"`
+	Old_email       string             `json:"old_email"`
+	New_email       string             `json:"new_email"`
+	Ip              string             `json:"ip"`
+	Created_at      time.Time          `json:"created_at"`
+	Expires_at      time.Time          `json:"expires_at"`
+	Undo_expires_at time.Time          `json:"undo_expires_at"`
+	Confirmed_at    *time.Time         `json:"confirmed_at,omitempty"`
+	Cancelled_at    *time.Time         `json:"cancelled_at,omitempty"`
+	Undone_at       *time.Time         `json:"undone_at,omitempty"`
+}
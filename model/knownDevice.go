@@ -0,0 +1,28 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// KnownDevice is a device a user has signed in from. Device_id is the id in the device
+// token the device keeps, which is the only way it is recognized as known. Fingerprint, a
+// hash of its user agent and network, only spares a client that doesn't keep the token
+// new device emails and confirmations. The location comes from the GeoIP database and is
+// only set when Located is.
+type KnownDevice struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	User_id       string             `json:"user_id"`
+	Device_id     string             `json:"device_id"`
+	Fingerprint   string             `json:"-"`
+	Device        string             `json:"device"`
+	User_agent    string             `json:"user_agent"`
+	Ip            string             `json:"ip"`
+	Located       bool               `json:"located"`
+	Country       string             `json:"country,omitempty"`
+	City          string             `json:"city,omitempty"`
+	Latitude      float64            `json:"-"`
+	Longitude     float64            `json:"-"`
+	First_seen_at time.Time          `json:"first_seen_at"`
+	Last_seen_at  time.Time          `json:"last_seen_at"`
+}
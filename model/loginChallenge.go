@@ -0,0 +1,25 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// LoginChallenge is a login that passed the password check but has to be confirmed with
+// one of Methods before a session is created, because it came from a new device or from
+// an implausible place. Only hashes of the challenge token and of the emailed code are
+// stored. Device is the device the login came from, remembered once the login completes.
+type LoginChallenge struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Token_hash string             `json:"-"`
+	Code_hash  string             `json:"-"`
+	User_id    string             `json:"user_id"`
+	Methods    []string           `json:"methods"`
+	Reason     string             `json:"reason"`
+	Device     KnownDevice        `json:"device"`
+	New_device bool               `json:"new_device"`
+	Attempts   int                `json:"attempts"`
+	Created_at time.Time          `json:"created_at"`
+	Expires_at time.Time          `json:"expires_at"`
+	Used_at    *time.Time         `json:"used_at,omitempty"`
+}
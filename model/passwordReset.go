@@ -0,0 +1,18 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// PasswordReset is a pending request to reset a forgotten password. Only a hash of the
+// token emailed to the user is stored, and Used_at is set once it has been redeemed.
+type PasswordReset struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Token_hash string             `json:"-"`
+	User_id    string             `json:"user_id"`
+	Ip         string             `json:"ip"`
+	Created_at time.Time          `json:"created_at"`
+	Expires_at time.Time          `json:"expires_at"`
+	Used_at    *time.Time         `json:"used_at,omitempty"`
+}
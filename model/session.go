@@ -0,0 +1,30 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Session is created for every successful login and owns the refresh token issued with it,
+// so each device can be listed and signed out on its own. Only a hash of the current
+// refresh token is stored. Impersonator_id is set on the short-lived sessions an ADMIN
+// opens to act as the user, so the user can see and end them. Auth_time is when the user
+// last proved who they are on the session, at login or when reauthenticating, and Amr
+// lists the methods they used then, as RFC 8176 names them.
+type Session struct {
+	ID                 primitive.ObjectID `bson:"_id"`
+	Session_id         string             `json:"session_id"`
+	User_id            string             `json:"user_id"`
+	Device             string             `json:"device"`
+	User_agent         string             `json:"user_agent"`
+	Ip                 string             `json:"ip"`
+	Refresh_token_hash string             `json:"-"`
+	Created_at         time.Time          `json:"created_at"`
+	Last_used_at       time.Time          `json:"last_used_at"`
+	Expires_at         time.Time          `json:"expires_at"`
+	Revoked_at         *time.Time         `json:"revoked_at,omitempty"`
+	Impersonator_id    string             `json:"impersonator_id,omitempty"`
+	Auth_time          time.Time          `json:"auth_time"`
+	Amr                []string           `json:"amr,omitempty"`
+	Current            bool               `json:"current" bson:"-"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// SigningKey is an RSA key pair used to sign tokens. Exactly one key is active at a time;
+// keys that were rotated out keep being published in the JWKS until every token they
+// signed has expired. Private_key is the PEM of the private key sealed with SECRET_KEY.
+type SigningKey struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	Kid            string             `json:"kid"`
+	Algorithm      string             `json:"algorithm"`
+	Private_key    string             `json:"-"`
+	Active         bool               `json:"active"`
+	Created_at     time.Time          `json:"created_at"`
+	Deactivated_at *time.Time         `json:"deactivated_at"`
+}
@@ -5,17 +5,71 @@ import (
 	"time"
 )
 
+// User is a registered account. Token and Refresh_token are only filled in on the login
+// response; the tokens themselves live on the login's Session and are never stored here.
+// Passwords are checked by the password policy of the service package, not a validate tag.
+// Password_history keeps the hashes of the previous passwords so they can't be reused, and
+// Password_changed_at is when the current one was set; users from before it existed count
+// from Created_at.
+// Totp_secret is the sealed secret of the user's authenticator app once Totp_enabled_at is
+// set; Totp_pending_secret holds a new one until a code from it is confirmed, and
+// Totp_last_step is the time step of the last code used, which can't be used again.
+// Locked_at is set while an administrator has locked the account.
+// Failed_logins counts the recent failed logins from unknown devices, and Lockout_until is
+// set while too many of them have locked the account for a while.
+// Status is one of the User* status constants; users stored before it existed have none
+// and count as active.
 type User struct {
 	ID            primitive.ObjectID `bson:"_id"`
 	First_name    *string            `json:"first_name" validate:"required,min=2,max=100"`
 	Last_name     *string            `json:"last_name" validate:"required,min=2,max=100"`
-	Password      *string            `json:"Password" validate:"required,min=6"`
+	Password      *string            `json:"Password,omitempty" validate:"required"`
 	Email         *string            `json:"email" validate:"email,required"`
 	Phone         *string            `json:"phone" validate:"required"`
-	Token         *string            `json:"token"`
+	Token         *string            `json:"token" bson:"-"`
 	User_type     *string            `json:"user_type" validate:"required,eq=ADMIN|eq=USER"`
-	Refresh_token *string            `json:"refresh_token"`
+	Refresh_token *string            `json:"refresh_token" bson:"-"`
 	Created_at    time.Time          `json:"created_at"`
 	Updated_at    time.Time          `json:"updated_at"`
 	User_id       string             `json:"user_id"`
+	Locked_at     *time.Time         `json:"locked_at,omitempty"`
+	Status        string             `json:"status"`
+	Status_reason string             `json:"status_reason,omitempty"`
+	Deleted_at    *time.Time         `json:"deleted_at,omitempty"`
+
+	Failed_logins     int        `json:"failed_logins,omitempty"`
+	Last_failed_login *time.Time `json:"last_failed_login,omitempty"`
+	Lockout_until     *time.Time `json:"lockout_until,omitempty"`
+
+	Password_history    []string   `json:"-"`
+	Password_changed_at *time.Time `json:"password_changed_at,omitempty"`
+
+	Totp_secret         string     `json:"-"`
+	Totp_pending_secret string     `json:"-"`
+	Totp_last_step      int64      `json:"-"`
+	Totp_enabled_at     *time.Time `json:"totp_enabled_at,omitempty"`
+}
+
+// PasswordChangedAt returns when the user's password was last set.
+func (u User) PasswordChangedAt() time.Time {
+	if u.Password_changed_at != nil {
+		return *u.Password_changed_at
+	}
+	return u.Created_at
+}
+
+// User statuses. Only active users can sign in or use their tokens and API keys.
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+	UserPending   = "pending"
+	UserDeleted   = "deleted"
+)
+
+// CurrentStatus returns the user's status, treating a missing status as active.
+func (u User) CurrentStatus() string {
+	if u.Status == "" {
+		return UserActive
+	}
+	return u.Status
 }
@@ -0,0 +1,58 @@
+package passwordhash
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// MaxArgon2Memory is the most memory, in KiB, an Argon2id hash may take. Hashes asking for
+// more are refused rather than computed.
+const MaxArgon2Memory = 1 << 20
+
+// Argon2id hashes with Argon2id. Memory is in KiB.
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen int
+}
+
+func (a Argon2id) Algorithm() string {
+	return "argon2id"
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt, err := newSalt(a.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+	return formatPHC("argon2id", argon2.Version, fmt.Sprintf("m=%d,t=%d,p=%d", a.Memory, a.Time, a.Threads), salt, hash), nil
+}
+
+func (a Argon2id) Verify(password string, encoded string) (bool, error) {
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return false, err
+	}
+	memory, time, threads := phc.params["m"], phc.params["t"], phc.params["p"]
+	if phc.id != "argon2id" || phc.version != argon2.Version || time <= 0 || threads <= 0 || threads > 255 ||
+		memory < 8*threads {
+		return false, ErrMalformedHash
+	}
+	if memory > MaxArgon2Memory {
+		return false, ErrCostTooHigh
+	}
+	hash := argon2.IDKey([]byte(password), phc.salt, uint32(time), uint32(memory), uint8(threads), uint32(len(phc.hash)))
+	return subtle.ConstantTimeCompare(hash, phc.hash) == 1, nil
+}
+
+func (a Argon2id) NeedsRehash(encoded string) bool {
+	phc, err := parsePHC(encoded)
+	return err != nil || phc.version != argon2.Version || phc.params["m"] < int(a.Memory) ||
+		phc.params["t"] < int(a.Time) || phc.params["p"] < int(a.Threads) ||
+		len(phc.hash) < int(a.KeyLen) || len(phc.salt) < a.SaltLen
+}
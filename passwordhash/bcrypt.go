@@ -0,0 +1,32 @@
+package passwordhash
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt hashes with bcrypt, which only looks at the first 72 bytes of a password.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Algorithm() string {
+	return "bcrypt"
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	return string(hash), err
+}
+
+func (b Bcrypt) Verify(password string, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b Bcrypt) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < b.Cost
+}
@@ -0,0 +1,149 @@
+// Package passwordhash hashes passwords with bcrypt, scrypt or Argon2id behind a common
+// interface. scrypt and Argon2id hashes are encoded in the PHC string format, such as
+// "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>"; bcrypt hashes keep their usual "$2a$"
+// format so hashes stored before this package existed still verify.
+package passwordhash
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownAlgorithm is returned for a hash that no configured hasher understands.
+var ErrUnknownAlgorithm = errors.New("passwordhash: unknown hash algorithm")
+
+// ErrMalformedHash is returned for a hash that can't be parsed.
+var ErrMalformedHash = errors.New("passwordhash: malformed hash")
+
+// ErrCostTooHigh is returned for a hash, or hasher, whose parameters would take more memory
+// or work than this package is willing to spend on one password.
+var ErrCostTooHigh = errors.New("passwordhash: hash parameters exceed the allowed cost")
+
+// PasswordHasher hashes and verifies passwords with one algorithm.
+type PasswordHasher interface {
+	// Algorithm is the name the hasher's hashes are identified by, such as "argon2id".
+	Algorithm() string
+	// Hash returns the encoded hash of password with a new random salt.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, a hash made by this algorithm.
+	Verify(password string, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded was made with weaker parameters than the hasher's.
+	NeedsRehash(encoded string) bool
+}
+
+// Hashers hashes new passwords with Current and verifies each stored hash with the hasher
+// of its algorithm, so the algorithm can change without resetting anybody's password.
+type Hashers struct {
+	Current PasswordHasher
+	byName  map[string]PasswordHasher
+}
+
+// NewHashers returns Hashers hashing with current and verifying with any of hashers.
+func NewHashers(current PasswordHasher, hashers ...PasswordHasher) *Hashers {
+	h := &Hashers{Current: current, byName: map[string]PasswordHasher{current.Algorithm(): current}}
+	for _, hasher := range hashers {
+		if _, ok := h.byName[hasher.Algorithm()]; !ok {
+			h.byName[hasher.Algorithm()] = hasher
+		}
+	}
+	return h
+}
+
+// Hash hashes password with the current hasher.
+func (h *Hashers) Hash(password string) (string, error) {
+	return h.Current.Hash(password)
+}
+
+// Verify reports whether password matches encoded and, when it does, whether encoded should
+// be replaced by a hash from the current hasher because it uses another algorithm or
+// weaker parameters.
+func (h *Hashers) Verify(password string, encoded string) (valid bool, rehash bool, err error) {
+	algorithm := Algorithm(encoded)
+	hasher, ok := h.byName[algorithm]
+	if !ok {
+		return false, false, ErrUnknownAlgorithm
+	}
+	if valid, err = hasher.Verify(password, encoded); !valid || err != nil {
+		return false, false, err
+	}
+	return true, algorithm != h.Current.Algorithm() || h.Current.NeedsRehash(encoded), nil
+}
+
+// Algorithm returns the algorithm encoded was made with, or an empty string.
+func Algorithm(encoded string) string {
+	if strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$") {
+		return "bcrypt"
+	}
+	if !strings.HasPrefix(encoded, "$") {
+		return ""
+	}
+	name, _, _ := strings.Cut(encoded[1:], "$")
+	return name
+}
+
+// phcHash is a parsed PHC string: $<id>[$v=<version>]$<params>$<salt>$<hash>.
+type phcHash struct {
+	id      string
+	version int
+	params  map[string]int
+	salt    []byte
+	hash    []byte
+}
+
+func parsePHC(encoded string) (phcHash, error) {
+	var phc phcHash
+	fields := strings.Split(encoded, "$")
+	if len(fields) < 5 || fields[0] != "" {
+		return phc, ErrMalformedHash
+	}
+	phc.id, fields = fields[1], fields[2:]
+	if strings.HasPrefix(fields[0], "v=") {
+		version, err := strconv.Atoi(fields[0][2:])
+		if err != nil {
+			return phc, ErrMalformedHash
+		}
+		phc.version, fields = version, fields[1:]
+	}
+	if len(fields) != 3 {
+		return phc, ErrMalformedHash
+	}
+
+	phc.params = map[string]int{}
+	for _, param := range strings.Split(fields[0], ",") {
+		name, value, ok := strings.Cut(param, "=")
+		n, err := strconv.Atoi(value)
+		if !ok || err != nil || n < 0 {
+			return phc, ErrMalformedHash
+		}
+		phc.params[name] = n
+	}
+
+	var err error
+	if phc.salt, err = base64.RawStdEncoding.DecodeString(fields[1]); err != nil {
+		return phc, ErrMalformedHash
+	}
+	if phc.hash, err = base64.RawStdEncoding.DecodeString(fields[2]); err != nil || len(phc.hash) == 0 {
+		return phc, ErrMalformedHash
+	}
+	return phc, nil
+}
+
+// formatPHC encodes a hash as a PHC string; params is already formatted, such as "m=65536,t=3,p=4".
+func formatPHC(id string, version int, params string, salt []byte, hash []byte) string {
+	versionField := ""
+	if version > 0 {
+		versionField = fmt.Sprintf("$v=%d", version)
+	}
+	return "$" + id + versionField + "$" + params + "$" +
+		base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(hash)
+}
+
+func newSalt(length int) ([]byte, error) {
+	salt := make([]byte, length)
+	_, err := rand.Read(salt)
+	return salt, err
+}
@@ -0,0 +1,274 @@
+package passwordhash
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Cheap parameters keep the tests fast; the algorithms behave the same at any cost.
+var (
+	testArgon2 = Argon2id{Time: 1, Memory: 64, Threads: 1, KeyLen: 16, SaltLen: 8}
+	testScrypt = Scrypt{LogN: 4, R: 8, P: 1, KeyLen: 16, SaltLen: 8}
+	testBcrypt = Bcrypt{Cost: 4}
+)
+
+func TestFormatAndParsePHC(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		version int
+		params  string
+		want    map[string]int
+	}{
+		{"argon2id with version", "argon2id", 19, "m=65536,t=3,p=4", map[string]int{"m": 65536, "t": 3, "p": 4}},
+		{"scrypt without version", "scrypt", 0, "ln=15,r=8,p=1", map[string]int{"ln": 15, "r": 8, "p": 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			salt, hash := []byte("0123456789abcdef"), []byte("hash bytes")
+			encoded := formatPHC(test.id, test.version, test.params, salt, hash)
+
+			phc, err := parsePHC(encoded)
+			if err != nil {
+				t.Fatalf("parsePHC(%q): %v", encoded, err)
+			}
+			if phc.id != test.id || phc.version != test.version {
+				t.Errorf("got id %q version %d, want %q version %d", phc.id, phc.version, test.id, test.version)
+			}
+			for name, value := range test.want {
+				if phc.params[name] != value {
+					t.Errorf("param %s = %d, want %d", name, phc.params[name], value)
+				}
+			}
+			if !bytes.Equal(phc.salt, salt) || !bytes.Equal(phc.hash, hash) {
+				t.Errorf("salt or hash didn't survive the round trip")
+			}
+		})
+	}
+}
+
+func TestParsePHCMalformed(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"no leading dollar", "argon2id$v=19$m=1,t=1,p=1$c2FsdA$aGFzaA"},
+		{"too few fields", "$argon2id$m=1,t=1,p=1$c2FsdA"},
+		{"too many fields", "$argon2id$v=19$m=1,t=1,p=1$c2FsdA$aGFzaA$extra"},
+		{"bad version", "$argon2id$v=x$m=1,t=1,p=1$c2FsdA$aGFzaA"},
+		{"param without value", "$scrypt$ln,r=8,p=1$c2FsdA$aGFzaA"},
+		{"negative param", "$scrypt$ln=-1,r=8,p=1$c2FsdA$aGFzaA"},
+		{"bad salt", "$scrypt$ln=4,r=8,p=1$!!$aGFzaA"},
+		{"empty hash", "$scrypt$ln=4,r=8,p=1$c2FsdA$"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parsePHC(test.encoded); err != ErrMalformedHash {
+				t.Errorf("parsePHC(%q) = %v, want ErrMalformedHash", test.encoded, err)
+			}
+		})
+	}
+}
+
+func TestAlgorithm(t *testing.T) {
+	tests := []struct {
+		encoded string
+		want    string
+	}{
+		{"$2a$10$abcdefghijklmnopqrstuv", "bcrypt"},
+		{"$2b$10$abcdefghijklmnopqrstuv", "bcrypt"},
+		{"$2y$10$abcdefghijklmnopqrstuv", "bcrypt"},
+		{"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA", "argon2id"},
+		{"$scrypt$ln=4,r=8,p=1$c2FsdA$aGFzaA", "scrypt"},
+		{"plaintext", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := Algorithm(test.encoded); got != test.want {
+			t.Errorf("Algorithm(%q) = %q, want %q", test.encoded, got, test.want)
+		}
+	}
+}
+
+func TestHashAndVerify(t *testing.T) {
+	for _, hasher := range []PasswordHasher{testArgon2, testScrypt, testBcrypt} {
+		t.Run(hasher.Algorithm(), func(t *testing.T) {
+			encoded, err := hasher.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if got := Algorithm(encoded); got != hasher.Algorithm() {
+				t.Errorf("Algorithm of the hash = %q, want %q", got, hasher.Algorithm())
+			}
+
+			tests := []struct {
+				password string
+				want     bool
+			}{
+				{"correct horse", true},
+				{"correct horsE", false},
+				{"", false},
+			}
+			for _, test := range tests {
+				valid, err := hasher.Verify(test.password, encoded)
+				if err != nil || valid != test.want {
+					t.Errorf("Verify(%q) = %v, %v; want %v", test.password, valid, err, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	scryptHash, _ := testScrypt.Hash("password")
+	argon2Hash, _ := testArgon2.Hash("password")
+	scryptWith := func(params string) string {
+		return strings.Replace(scryptHash, "ln=4,r=8,p=1", params, 1)
+	}
+	tests := []struct {
+		name    string
+		hasher  PasswordHasher
+		encoded string
+		wantErr error
+	}{
+		{"argon2id given scrypt", testArgon2, scryptHash, ErrMalformedHash},
+		{"scrypt given argon2id", testScrypt, argon2Hash, ErrMalformedHash},
+		{"argon2id without threads", testArgon2, strings.Replace(argon2Hash, "p=1", "p=0", 1), ErrMalformedHash},
+		{"scrypt without r", testScrypt, scryptWith("ln=4,r=0,p=1"), ErrMalformedHash},
+		{"argon2id with too much memory", testArgon2, strings.Replace(argon2Hash, "m=64", "m=2097152", 1), ErrCostTooHigh},
+		{"scrypt with ln over 30", testScrypt, scryptWith("ln=31,r=8,p=1"), ErrCostTooHigh},
+		{"scrypt needing 1 TiB", testScrypt, scryptWith("ln=30,r=8,p=1"), ErrCostTooHigh},
+		{"scrypt just over 1 GiB", testScrypt, scryptWith("ln=20,r=9,p=1"), ErrCostTooHigh},
+		{"scrypt with a huge r", testScrypt, scryptWith("ln=1,r=1000000000,p=1"), ErrCostTooHigh},
+		{"scrypt with too much parallelism", testScrypt, scryptWith("ln=4,r=8,p=17"), ErrCostTooHigh},
+		{"scrypt with a huge p", testScrypt, scryptWith("ln=4,r=8,p=1000000000"), ErrCostTooHigh},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid, err := test.hasher.Verify("password", test.encoded); valid || err != test.wantErr {
+				t.Errorf("Verify = %v, %v; want false, %v", valid, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestScryptCostLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		hasher  Scrypt
+		wantErr error
+	}{
+		{"within the limits", Scrypt{LogN: 4, R: 8, P: MaxScryptP, KeyLen: 16, SaltLen: 8}, nil},
+		{"exactly 1 GiB", Scrypt{LogN: 20, R: 8, P: 1, KeyLen: 16, SaltLen: 8}, nil},
+		{"over 1 GiB", Scrypt{LogN: 20, R: 9, P: 1, KeyLen: 16, SaltLen: 8}, ErrCostTooHigh},
+		{"huge r", Scrypt{LogN: 1, R: 1 << 40, P: 1, KeyLen: 16, SaltLen: 8}, ErrCostTooHigh},
+		{"too much parallelism", Scrypt{LogN: 4, R: 8, P: MaxScryptP + 1, KeyLen: 16, SaltLen: 8}, ErrCostTooHigh},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Only check the parameters; computing a 1 GiB hash would make the test slow
+			if test.wantErr == nil {
+				if !scryptCostOK(test.hasher.LogN, test.hasher.R, test.hasher.P) {
+					t.Errorf("parameters refused, want them accepted")
+				}
+				return
+			}
+			if _, err := test.hasher.Hash("password"); err != test.wantErr {
+				t.Errorf("Hash error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	argon2Hash, _ := testArgon2.Hash("password")
+	scryptHash, _ := testScrypt.Hash("password")
+	bcryptHash, _ := testBcrypt.Hash("password")
+
+	stronger := testArgon2
+	stronger.Memory *= 2
+	moreTime := testArgon2
+	moreTime.Time++
+	longerKey := testArgon2
+	longerKey.KeyLen *= 2
+	higherCost := testScrypt
+	higherCost.LogN++
+
+	tests := []struct {
+		name    string
+		hasher  PasswordHasher
+		encoded string
+		want    bool
+	}{
+		{"argon2id with the same parameters", testArgon2, argon2Hash, false},
+		{"argon2id with more memory", stronger, argon2Hash, true},
+		{"argon2id with more time", moreTime, argon2Hash, true},
+		{"argon2id with a longer key", longerKey, argon2Hash, true},
+		{"argon2id given a malformed hash", testArgon2, "$argon2id$garbage", true},
+		{"scrypt with the same parameters", testScrypt, scryptHash, false},
+		{"scrypt with a higher cost", higherCost, scryptHash, true},
+		{"bcrypt with the same cost", testBcrypt, bcryptHash, false},
+		{"bcrypt with a higher cost", Bcrypt{Cost: 5}, bcryptHash, true},
+		{"bcrypt with a lower cost", Bcrypt{Cost: 4}, bcryptHash, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.hasher.NeedsRehash(test.encoded); got != test.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHashersVerify(t *testing.T) {
+	hashers := NewHashers(testArgon2, testArgon2, testScrypt, testBcrypt)
+	argon2Hash, _ := testArgon2.Hash("password")
+	scryptHash, _ := testScrypt.Hash("password")
+	bcryptHash, _ := testBcrypt.Hash("password")
+	weakArgon2 := testArgon2
+	weakArgon2.Memory = 32
+	weakHash, _ := weakArgon2.Hash("password")
+
+	tests := []struct {
+		name       string
+		password   string
+		encoded    string
+		wantValid  bool
+		wantRehash bool
+		wantErr    error
+	}{
+		{"current algorithm and parameters", "password", argon2Hash, true, false, nil},
+		{"current algorithm with weaker parameters", "password", weakHash, true, true, nil},
+		{"scrypt falls back and is rehashed", "password", scryptHash, true, true, nil},
+		{"bcrypt falls back and is rehashed", "password", bcryptHash, true, true, nil},
+		{"wrong password is never rehashed", "wrong", scryptHash, false, false, nil},
+		{"unknown algorithm", "password", "$md5$abc", false, false, ErrUnknownAlgorithm},
+		{"not a hash", "password", "password", false, false, ErrUnknownAlgorithm},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			valid, rehash, err := hashers.Verify(test.password, test.encoded)
+			if valid != test.wantValid || rehash != test.wantRehash || err != test.wantErr {
+				t.Errorf("Verify = %v, %v, %v; want %v, %v, %v", valid, rehash, err, test.wantValid, test.wantRehash, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestHashersHashUsesCurrent(t *testing.T) {
+	for _, current := range []PasswordHasher{testArgon2, testScrypt, testBcrypt} {
+		hashers := NewHashers(current, testArgon2, testScrypt, testBcrypt)
+		encoded, err := hashers.Hash("password")
+		if err != nil {
+			t.Fatalf("Hash with %s: %v", current.Algorithm(), err)
+		}
+		if got := Algorithm(encoded); got != current.Algorithm() {
+			t.Errorf("Hash with current %s made a %s hash", current.Algorithm(), got)
+		}
+		if valid, rehash, err := hashers.Verify("password", encoded); !valid || rehash || err != nil {
+			t.Errorf("Verify of a fresh %s hash = %v, %v, %v; want true, false, nil", current.Algorithm(), valid, rehash, err)
+		}
+	}
+}
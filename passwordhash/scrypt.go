@@ -0,0 +1,76 @@
+package passwordhash
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// MaxScryptMemory is the most memory, in bytes, an scrypt hash may take: 128·N·r. Hashes
+// asking for more are refused rather than computed, like Argon2id hashes over MaxArgon2Memory.
+const MaxScryptMemory = 1 << 30
+
+// MaxScryptP is the highest scrypt parallelism accepted; each unit of it repeats the work.
+const MaxScryptP = 16
+
+// Scrypt hashes with scrypt. LogN is the base 2 logarithm of the CPU and memory cost N.
+type Scrypt struct {
+	LogN    int
+	R       int
+	P       int
+	KeyLen  int
+	SaltLen int
+}
+
+func (s Scrypt) Algorithm() string {
+	return "scrypt"
+}
+
+func (s Scrypt) Hash(password string) (string, error) {
+	if !scryptCostOK(s.LogN, s.R, s.P) {
+		return "", ErrCostTooHigh
+	}
+	salt, err := newSalt(s.SaltLen)
+	if err != nil {
+		return "", err
+	}
+	hash, err := scrypt.Key([]byte(password), salt, 1<<s.LogN, s.R, s.P, s.KeyLen)
+	if err != nil {
+		return "", err
+	}
+	return formatPHC("scrypt", 0, fmt.Sprintf("ln=%d,r=%d,p=%d", s.LogN, s.R, s.P), salt, hash), nil
+}
+
+func (s Scrypt) Verify(password string, encoded string) (bool, error) {
+	phc, err := parsePHC(encoded)
+	if err != nil {
+		return false, err
+	}
+	logN, r, p := phc.params["ln"], phc.params["r"], phc.params["p"]
+	if phc.id != "scrypt" || logN <= 0 || r <= 0 || p <= 0 {
+		return false, ErrMalformedHash
+	}
+	if !scryptCostOK(logN, r, p) {
+		return false, ErrCostTooHigh
+	}
+	hash, err := scrypt.Key([]byte(password), phc.salt, 1<<logN, r, p, len(phc.hash))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(hash, phc.hash) == 1, nil
+}
+
+func (s Scrypt) NeedsRehash(encoded string) bool {
+	phc, err := parsePHC(encoded)
+	return err != nil || phc.params["ln"] < s.LogN || phc.params["r"] < s.R || phc.params["p"] < s.P ||
+		len(phc.hash) < s.KeyLen || len(phc.salt) < s.SaltLen
+}
+
+// scryptCostOK reports whether the parameters stay within MaxScryptMemory and MaxScryptP.
+func scryptCostOK(logN int, r int, p int) bool {
+	if logN > 30 || p > MaxScryptP || r > MaxScryptMemory/128 {
+		return false
+	}
+	return 128*(int64(1)<<logN)*int64(r) <= MaxScryptMemory
+}
@@ -0,0 +1,4 @@
+// Package authv1 contains the generated protobuf and gRPC code for auth.proto.
+package authv1
+
+//go:generate sh -c "cd ../.. && buf generate"
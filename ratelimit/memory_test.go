@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreBurstAndWait(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Burst: 3, Per: time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < limit.Burst; i++ {
+		if wait, err := store.Take(ctx, "key", limit); wait != 0 || err != nil {
+			t.Fatalf("take %d = %v, %v; want a token", i+1, wait, err)
+		}
+	}
+	wait, err := store.Take(ctx, "key", limit)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	// One token comes back every 20s; only moments passed since the bucket was emptied
+	if wait <= 19*time.Second || wait > 20*time.Second {
+		t.Errorf("wait = %v, want just under 20s", wait)
+	}
+
+	if wait, _ := store.Take(ctx, "other", limit); wait != 0 {
+		t.Errorf("another key waits %v, want its own full bucket", wait)
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	limit := Limit{Burst: 2, Per: time.Minute}
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		takes   int // tokens that should be available after elapsed
+	}{
+		{"nothing refilled", 0, 0},
+		{"one token refilled", 30 * time.Second, 1},
+		{"refilled completely", time.Minute, 2},
+		{"never more than the burst", time.Hour, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			for i := 0; i < limit.Burst; i++ {
+				store.Take(ctx, "key", limit)
+			}
+			store.buckets["key"].updated = store.buckets["key"].updated.Add(-test.elapsed)
+
+			for i := 0; i < test.takes; i++ {
+				if wait, _ := store.Take(ctx, "key", limit); wait != 0 {
+					t.Fatalf("take %d waits %v, want a token", i+1, wait)
+				}
+			}
+			if wait, _ := store.Take(ctx, "key", limit); wait == 0 {
+				t.Errorf("take %d got a token, want to wait", test.takes+1)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Burst: 5, Per: time.Minute}
+	ctx := context.Background()
+	store.Take(ctx, "full", limit)
+	store.Take(ctx, "recent", limit)
+	store.Take(ctx, "long", Limit{Burst: 5, Per: time.Hour})
+
+	store.buckets["full"].updated = time.Now().Add(-2 * time.Minute)
+	store.buckets["long"].updated = time.Now().Add(-2 * time.Minute)
+
+	// Not due yet, so nothing is dropped
+	store.Take(ctx, "trigger", limit)
+	if _, ok := store.buckets["full"]; !ok {
+		t.Fatalf("bucket swept before the sweep interval passed")
+	}
+
+	store.lastSweep = time.Now().Add(-sweepInterval)
+	store.Take(ctx, "trigger", limit)
+	tests := []struct {
+		key  string
+		kept bool
+	}{
+		{"full", false},
+		{"recent", true},
+		{"long", true},
+		{"trigger", true},
+	}
+	for _, test := range tests {
+		if _, ok := store.buckets[test.key]; ok != test.kept {
+			t.Errorf("bucket %q kept = %v, want %v", test.key, ok, test.kept)
+		}
+	}
+}
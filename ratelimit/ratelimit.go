@@ -0,0 +1,95 @@
+// Package ratelimit implements token bucket rate limits on top of a Store, which is either
+// kept in memory for a single instance or in Redis so every instance shares the buckets.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows bursts of up to Burst requests, refilling at Burst requests every Per.
+// The zero Limit allows everything.
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Per > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return strconv.Itoa(l.Burst) + "/" + l.Per.String()
+}
+
+// ParseLimit parses a limit written as "<burst>/<duration>", such as "5/1m". "off" and "0"
+// disable the limit.
+func ParseLimit(value string) (Limit, error) {
+	if value == "off" || value == "0" {
+		return Limit{}, nil
+	}
+	burst, per, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <burst>/<duration>", value)
+	}
+	n, err := strconv.Atoi(burst)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad burst", value)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad duration", value)
+	}
+	return Limit{Burst: n, Per: d}, nil
+}
+
+// Store keeps token buckets by key.
+type Store interface {
+	// Take removes a token from the bucket for key, refilled according to limit. It returns
+	// zero when a token was available, or else how long until one will be.
+	Take(ctx context.Context, key string, limit Limit) (time.Duration, error)
+}
+
+// Limiter takes tokens from the buckets of a Store.
+type Limiter struct {
+	Store    Store
+	Fallback Store  // takes over while Store fails, such as a MemoryStore in front of Redis
+	Prefix   string // prepended to every key, so several services can share a Redis
+}
+
+// Allow takes a token from the bucket for key and reports how long the caller must wait
+// when none is left. While the store fails, the tokens come from Fallback, so an outage of
+// Redis neither locks everybody out nor lifts the limits. Without a Fallback, or when it
+// fails too, the failure is logged and the request allowed.
+func (l *Limiter) Allow(ctx context.Context, key string, limit Limit) (time.Duration, bool) {
+	if !limit.Enabled() {
+		return 0, true
+	}
+	wait, err := l.Store.Take(ctx, l.Prefix+key, limit)
+	if err != nil && l.Fallback != nil {
+		log.Println("error occurred while checking the rate limit of", key+", using the fallback store:", err)
+		wait, err = l.Fallback.Take(ctx, l.Prefix+key, limit)
+	}
+	if err != nil {
+		log.Println("error occurred while checking the rate limit of", key+":", err)
+		return 0, true
+	}
+	return wait, wait <= 0
+}
+
+// refill returns the tokens in a bucket that held tokens at updated, as of now.
+func refill(tokens float64, updated time.Time, now time.Time, limit Limit) float64 {
+	tokens += float64(now.Sub(updated)) * float64(limit.Burst) / float64(limit.Per)
+	if tokens > float64(limit.Burst) {
+		tokens = float64(limit.Burst)
+	}
+	return tokens
+}
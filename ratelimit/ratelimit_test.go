@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{"5/1m", Limit{Burst: 5, Per: time.Minute}, false},
+		{"100/1s", Limit{Burst: 100, Per: time.Second}, false},
+		{"off", Limit{}, false},
+		{"0", Limit{}, false},
+		{"5", Limit{}, true},
+		{"x/1m", Limit{}, true},
+		{"-1/1m", Limit{}, true},
+		{"5/soon", Limit{}, true},
+		{"5/0s", Limit{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseLimit(test.value)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("ParseLimit(%q) = %v, %v; want %v, error %v", test.value, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestRefill(t *testing.T) {
+	limit := Limit{Burst: 10, Per: 10 * time.Second}
+	updated := time.Now()
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 3, 0, 3},
+		{"one token per second", 3, 2 * time.Second, 5},
+		{"part of a token", 0, 500 * time.Millisecond, 0.5},
+		{"capped at the burst", 3, time.Minute, 10},
+		{"empty bucket refills completely after per", 0, 10 * time.Second, 10},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := refill(test.tokens, updated, updated.Add(test.elapsed), limit); got != test.want {
+				t.Errorf("refill = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+type fakeStore struct {
+	keys []string
+	wait time.Duration
+	err  error
+}
+
+func (s *fakeStore) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	s.keys = append(s.keys, key)
+	return s.wait, s.err
+}
+
+func TestLimiterAllow(t *testing.T) {
+	limit := Limit{Burst: 1, Per: time.Second}
+	tests := []struct {
+		name      string
+		store     *fakeStore
+		limit     Limit
+		wantWait  time.Duration
+		wantAllow bool
+		wantTakes int
+	}{
+		{"token available", &fakeStore{}, limit, 0, true, 1},
+		{"no token", &fakeStore{wait: time.Second}, limit, time.Second, false, 1},
+		{"disabled limit skips the store", &fakeStore{wait: time.Second}, Limit{}, 0, true, 0},
+		{"failing store without a fallback allows", &fakeStore{err: errors.New("down")}, limit, 0, true, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := &Limiter{Store: test.store, Prefix: "svc:"}
+			wait, allowed := limiter.Allow(context.Background(), "key", test.limit)
+			if wait != test.wantWait || allowed != test.wantAllow {
+				t.Errorf("Allow = %v, %v; want %v, %v", wait, allowed, test.wantWait, test.wantAllow)
+			}
+			if len(test.store.keys) != test.wantTakes {
+				t.Fatalf("store was asked %d times, want %d", len(test.store.keys), test.wantTakes)
+			}
+			if test.wantTakes > 0 && test.store.keys[0] != "svc:key" {
+				t.Errorf("key = %q, want the prefixed key", test.store.keys[0])
+			}
+		})
+	}
+}
+
+func TestLimiterFallback(t *testing.T) {
+	failing := &fakeStore{err: errors.New("down")}
+	fallback := NewMemoryStore()
+	limiter := &Limiter{Store: failing, Fallback: fallback, Prefix: "svc:"}
+	limit := Limit{Burst: 2, Per: time.Minute}
+	ctx := context.Background()
+
+	tests := []struct {
+		key       string
+		wantAllow bool
+	}{
+		{"login", true},
+		{"login", true},
+		{"login", false}, // the fallback enforces the limit while the store is down
+		{"signup", true},
+	}
+	for i, test := range tests {
+		wait, allowed := limiter.Allow(ctx, test.key, limit)
+		if allowed != test.wantAllow || (wait > 0) == allowed {
+			t.Errorf("request %d for %s = %v, %v; want allowed %v", i+1, test.key, wait, allowed, test.wantAllow)
+		}
+	}
+	if len(failing.keys) != len(tests) {
+		t.Errorf("store was asked %d times, want %d; it must still be tried first", len(failing.keys), len(tests))
+	}
+	if _, ok := fallback.buckets["svc:login"]; !ok {
+		t.Errorf("the fallback doesn't hold the prefixed key")
+	}
+
+	// Once the store is back, it decides again
+	failing.err = nil
+	if _, allowed := limiter.Allow(ctx, "login", limit); !allowed {
+		t.Errorf("request after the store recovered was refused, want the store's answer")
+	}
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript updates a bucket atomically. Buckets are hashes of the tokens left and the
+// time they were counted, in milliseconds, and expire once they would be full again.
+var takeScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local per = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or burst
+local updated = tonumber(state[2]) or now
+local rate = burst / per
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], per)
+return wait
+`)
+
+// RedisStore keeps buckets in Redis, or any server speaking its protocol and running Lua
+// scripts, so that every instance shares them.
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore returns a RedisStore connecting to url, such as redis://localhost:6379/0.
+func NewRedisStore(url string) (*RedisStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: redis.NewClient(options)}, nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	// The time comes from this instance, so keep the clocks of the instances in sync
+	wait, err := takeScript.Run(ctx, s.client, []string{key},
+		limit.Burst, limit.Per.Milliseconds(), time.Now().UnixMilli()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
@@ -0,0 +1,15 @@
+package route
+
+import (
+	"github.com/Danitilahun/GO_JWT_Authentication.git/controller"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func APIKeyRoutes(incomingRoutes *gin.Engine) {
+	authorized := incomingRoutes.Group("/")
+	authorized.Use(middleware.Authenticate())
+	authorized.POST("/users/me/api-keys", middleware.BlockImpersonation(), middleware.RequireRecentAuth(middleware.RecentAuthMaxAge), controller.CreateAPIKey())
+	authorized.GET("/users/me/api-keys", controller.GetAPIKeys())
+	authorized.DELETE("/users/me/api-keys/:key_id", middleware.BlockImpersonation(), controller.RevokeAPIKey())
+}
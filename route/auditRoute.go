@@ -0,0 +1,13 @@
+package route
+
+import (
+	"github.com/Danitilahun/GO_JWT_Authentication.git/controller"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func AuditRoutes(incomingRoutes *gin.Engine) {
+	authorized := incomingRoutes.Group("/")
+	authorized.Use(middleware.Authenticate())
+	authorized.GET("/audit", controller.GetAuditEvents())
+}
@@ -8,4 +8,6 @@ import (
 func AuthRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.POST("users/signup", controller.Signup())
 	incomingRoutes.POST("users/login", controller.Login())
+	incomingRoutes.POST("users/login/verify", controller.VerifyLogin())
+	incomingRoutes.POST("users/refresh", controller.Refresh())
 }
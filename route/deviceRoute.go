@@ -0,0 +1,17 @@
+package route
+
+import (
+	"github.com/Danitilahun/GO_JWT_Authentication.git/controller"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func DeviceRoutes(incomingRoutes *gin.Engine) {
+	authorized := incomingRoutes.Group("/")
+	authorized.Use(middleware.Authenticate())
+	authorized.GET("/users/me/devices", controller.GetDevices())
+	authorized.DELETE("/users/me/devices/:device_id", middleware.BlockImpersonation(), controller.ForgetDevice())
+	authorized.POST("/users/me/totp", middleware.BlockImpersonation(), middleware.RequireRecentAuth(middleware.RecentAuthMaxAge), controller.EnrollTOTP())
+	authorized.POST("/users/me/totp/confirm", middleware.BlockImpersonation(), controller.ConfirmTOTP())
+	authorized.POST("/users/me/totp/disable", middleware.BlockImpersonation(), middleware.RequireRecentAuth(middleware.RecentAuthMaxAge), controller.DisableTOTP())
+}
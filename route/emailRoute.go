@@ -0,0 +1,16 @@
+package route
+
+import (
+	"github.com/Danitilahun/GO_JWT_Authentication.git/controller"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func EmailRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/users/email/confirm", controller.ConfirmEmailChange())
+	incomingRoutes.POST("/users/email/undo", controller.UndoEmailChange())
+
+	authorized := incomingRoutes.Group("/")
+	authorized.Use(middleware.Authenticate())
+	authorized.POST("/users/me/email", middleware.BlockImpersonation(), middleware.RequireRecentAuth(middleware.RecentAuthMaxAge), controller.ChangeEmail())
+}
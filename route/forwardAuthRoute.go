@@ -0,0 +1,10 @@
+package route
+
+import (
+	"github.com/Danitilahun/GO_JWT_Authentication.git/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func ForwardAuthRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/auth/verify", controller.VerifyForwardAuth())
+}
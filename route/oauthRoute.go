@@ -0,0 +1,11 @@
+package route
+
+import (
+	"github.com/Danitilahun/GO_JWT_Authentication.git/controller"
+	"github.com/gin-gonic/gin"
+)
+
+func OAuthRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/oauth/introspect", controller.Introspect())
+	incomingRoutes.POST("/oauth/revoke", controller.Revoke())
+}
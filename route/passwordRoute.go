@@ -0,0 +1,17 @@
+package route
+
+import (
+	"github.com/Danitilahun/GO_JWT_Authentication.git/controller"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func PasswordRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.POST("/users/password/forgot", controller.ForgotPassword())
+	incomingRoutes.POST("/users/password/reset", controller.ResetPassword())
+	incomingRoutes.POST("/users/password/expired", controller.ChangeExpiredPassword())
+
+	authorized := incomingRoutes.Group("/")
+	authorized.Use(middleware.Authenticate())
+	authorized.PUT("/users/me/password", middleware.BlockImpersonation(), middleware.RequireRecentAuth(middleware.RecentAuthMaxAge), controller.ChangePassword())
+}
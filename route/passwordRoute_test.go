@@ -0,0 +1,124 @@
+//go:build integration
+
+package route
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Run with the MongoDB in MONGODB_URL and SECRET_KEY set; skipped when the database can't
+// be reached:
+//
+//	MONGODB_URL=mongodb://localhost:27017 SECRET_KEY=... go test -tags integration ./route/
+
+func TestChangePasswordRequiresRecentAuth(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := database.Client.Ping(ctx, nil); err != nil {
+		t.Skip("MongoDB is not reachable:", err)
+	}
+
+	user := insertTestUser(t, "Current-password-1")
+	session, err := helper.CreateSession(user.User_id, "test", "127.0.0.1", []string{helper.AmrPassword})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	stale := session
+	stale.Auth_time = time.Now().Add(-2 * middleware.RecentAuthMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	PasswordRoutes(router)
+
+	tests := []struct {
+		name           string
+		session        models.Session
+		wantStatus     int
+		wantReauth     bool
+		wantChallenged bool
+	}{
+		{"stale auth_time", stale, http.StatusUnauthorized, true, true},
+		// The wrong current password keeps the request from changing anything
+		{"fresh auth_time", session, http.StatusUnauthorized, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token, _, err := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id, test.session)
+			if err != nil {
+				t.Fatalf("GenerateAllTokens: %v", err)
+			}
+			body := `{"current_password":"Wrong-password-1","new_password":"New-password-2"}`
+			request := httptest.NewRequest(http.MethodPut, "/users/me/password", strings.NewReader(body))
+			request.Header.Set("Authorization", "Bearer "+token)
+			request.Header.Set("Content-Type", "application/json")
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			var response struct {
+				Reauthentication_required bool `json:"reauthentication_required"`
+			}
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+			if recorder.Code != test.wantStatus || response.Reauthentication_required != test.wantReauth {
+				t.Errorf("status %d, reauthentication_required %v; want %d, %v (body %s)",
+					recorder.Code, response.Reauthentication_required, test.wantStatus, test.wantReauth, recorder.Body)
+			}
+			challenged := strings.Contains(recorder.Header().Get("WWW-Authenticate"), "insufficient_user_authentication")
+			if challenged != test.wantChallenged {
+				t.Errorf("WWW-Authenticate %q, want an insufficient_user_authentication challenge: %v",
+					recorder.Header().Get("WWW-Authenticate"), test.wantChallenged)
+			}
+		})
+	}
+}
+
+// insertTestUser stores an active USER with password and removes the user and their
+// sessions after the test.
+func insertTestUser(t *testing.T, password string) models.User {
+	t.Helper()
+	hash, err := service.HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	id := primitive.NewObjectID()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	email := id.Hex() + "@example.com"
+	firstName, lastName, phone, userType := "Test", "User", id.Hex(), "USER"
+	user := models.User{
+		ID:                  id,
+		First_name:          &firstName,
+		Last_name:           &lastName,
+		Password:            &hash,
+		Email:               &email,
+		Phone:               &phone,
+		User_type:           &userType,
+		Created_at:          now,
+		Updated_at:          now,
+		User_id:             id.Hex(),
+		Status:              models.UserActive,
+		Password_changed_at: &now,
+	}
+	users := database.OpenCollection(database.Client, "auth", "user")
+	if _, err := users.InsertOne(context.Background(), user); err != nil {
+		t.Fatalf("inserting the test user: %v", err)
+	}
+	t.Cleanup(func() {
+		users.DeleteOne(context.Background(), bson.M{"user_id": user.User_id})
+		database.OpenCollection(database.Client, "auth", "session").DeleteMany(context.Background(), bson.M{"user_id": user.User_id})
+	})
+	return user
+}
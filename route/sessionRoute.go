@@ -0,0 +1,16 @@
+package route
+
+import (
+	"github.com/Danitilahun/GO_JWT_Authentication.git/controller"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func SessionRoutes(incomingRoutes *gin.Engine) {
+	authorized := incomingRoutes.Group("/")
+	authorized.Use(middleware.Authenticate())
+	authorized.GET("/users/me/sessions", controller.GetSessions())
+	authorized.DELETE("/users/me/sessions", middleware.BlockImpersonation(), controller.RevokeOtherSessions())
+	authorized.DELETE("/users/me/sessions/:session_id", middleware.BlockImpersonation(), controller.RevokeSession())
+	authorized.POST("/users/me/reauthenticate", middleware.BlockImpersonation(), controller.Reauthenticate())
+}
@@ -7,7 +7,15 @@ import (
 )
 
 func UserRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.Use(middleware.Authenticate())
-	incomingRoutes.GET("/users", controller.GetUsers())
-	incomingRoutes.GET("/users/:user_id", controller.GetUser())
+	authorized := incomingRoutes.Group("/")
+	authorized.Use(middleware.Authenticate())
+	authorized.GET("/users", controller.GetUsers())
+	authorized.GET("/users/:user_id", controller.GetUser())
+	authorized.PATCH("/users/:user_id/role", middleware.BlockImpersonation(), controller.SetUserRole())
+	authorized.POST("/users/:user_id/suspend", middleware.BlockImpersonation(), controller.SuspendUser())
+	authorized.POST("/users/:user_id/reactivate", middleware.BlockImpersonation(), controller.ReactivateUser())
+	authorized.DELETE("/users/:user_id", middleware.BlockImpersonation(), middleware.RequireRecentAuth(middleware.RecentAuthMaxAge), controller.DeleteUser())
+	authorized.POST("/users/:user_id/unlock", middleware.BlockImpersonation(), controller.UnlockUser())
+	authorized.POST("/users/:user_id/impersonate", middleware.BlockImpersonation(), controller.ImpersonateUser())
+	authorized.POST("/users/logout", controller.Logout())
 }
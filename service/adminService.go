@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var apiKeyCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "api_key")
+
+// The functions in this file are operator actions used by authctl. They don't check a
+// caller because they are only reachable by whoever can already reach the database.
+
+// CreateAdmin validates and stores a new ADMIN user.
+func CreateAdmin(ctx context.Context, user models.User) (models.User, error) {
+	userType := "ADMIN"
+	user.User_type = &userType
+	user, err := createUser(ctx, user)
+	if err != nil {
+		return user, err
+	}
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{Action: helper.AuditAdminCreated, Actor_id: "authctl", Target_id: user.User_id})
+	return user, nil
+}
+
+// FindUser looks a user up by email or user id.
+func FindUser(ctx context.Context, emailOrId string) (models.User, error) {
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"$or": []bson.M{
+		{"email": emailOrId},
+		{"user_id": emailOrId},
+	}}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, newError(NotFound, "user not found")
+	}
+	if err != nil {
+		return user, newError(Internal, err.Error())
+	}
+
+	sanitize(&user)
+	return user, nil
+}
+
+// ResetPassword sets a new password for userId and signs out all of their sessions.
+func ResetPassword(ctx context.Context, userId string, password string) error {
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return newError(NotFound, "user not found")
+	}
+	if err != nil {
+		return newError(Internal, err.Error())
+	}
+	if err := checkPassword(password, user); err != nil {
+		return err
+	}
+	if err := checkPasswordHistory(user, password); err != nil {
+		return err
+	}
+
+	if err := setPassword(ctx, user, password); err != nil {
+		return err
+	}
+
+	if _, err := helper.RevokeSessions(userId, bson.M{}); err != nil {
+		return newError(Internal, "error occurred while signing out the user's sessions")
+	}
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{Action: helper.AuditPasswordReset, Actor_id: "authctl", Target_id: userId})
+	return nil
+}
+
+// LockUser stops userId from signing in, signs out all of their sessions and suspends
+// their API keys until UnlockUser is called.
+func LockUser(ctx context.Context, userId string) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.M{"$set": bson.M{
+		"locked_at":  now,
+		"updated_at": now,
+	}})
+	if err != nil {
+		return newError(Internal, "error occurred while locking the user")
+	}
+	if result.MatchedCount == 0 {
+		return newError(NotFound, "user not found")
+	}
+
+	if _, err := helper.RevokeSessions(userId, bson.M{}); err != nil {
+		return newError(Internal, "error occurred while signing out the user's sessions")
+	}
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{Action: helper.AuditUserLocked, Actor_id: "authctl", Target_id: userId})
+	return nil
+}
+
+// UnlockUser lets a locked user sign in again, also lifting any lockout after failed logins.
+func UnlockUser(ctx context.Context, userId string) error {
+	return unlockUser(ctx, "authctl", userId)
+}
+
+// unlockUser lifts the lock and lockout of userId on behalf of actorId.
+func unlockUser(ctx context.Context, actorId string, userId string) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.M{
+		"$unset": bson.M{"locked_at": "", "failed_logins": "", "last_failed_login": "", "lockout_until": ""},
+		"$set":   bson.M{"updated_at": now},
+	})
+	if err != nil {
+		return newError(Internal, "error occurred while unlocking the user")
+	}
+	if result.MatchedCount == 0 {
+		return newError(NotFound, "user not found")
+	}
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{Action: helper.AuditUserUnlocked, Actor_id: actorId, Target_id: userId})
+	return nil
+}
+
+// RevokeTokens signs out every session of userId and, when apiKeys is set, revokes their
+// API keys as well. It returns how many sessions and keys were revoked.
+func RevokeTokens(ctx context.Context, userId string, apiKeys bool) (sessions int64, keys int64, err error) {
+	defer func() {
+		helper.RecordAuditEvent(ctx, models.AuditEvent{
+			Action:    helper.AuditTokenRevoked,
+			Actor_id:  "authctl",
+			Target_id: userId,
+			Details:   map[string]string{"sessions": strconv.FormatInt(sessions, 10), "api_keys": strconv.FormatInt(keys, 10)},
+		})
+	}()
+
+	sessions, err = helper.RevokeSessions(userId, bson.M{})
+	if err != nil {
+		return 0, 0, newError(Internal, "error occurred while signing out the user's sessions")
+	}
+	if !apiKeys {
+		return sessions, 0, nil
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := apiKeyCollection.UpdateMany(ctx,
+		bson.M{"user_id": userId, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": now}},
+	)
+	if err != nil {
+		return sessions, 0, newError(Internal, "error occurred while revoking the user's api keys")
+	}
+	return sessions, result.ModifiedCount, nil
+}
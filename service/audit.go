@@ -0,0 +1,19 @@
+package service
+
+import (
+	"context"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+)
+
+// audit records event, marking it as failed with the error's message when err is set.
+func audit(ctx context.Context, event models.AuditEvent, err error) {
+	if err != nil {
+		event.Outcome = helper.AuditFailure
+		if event.Details == nil {
+			event.Details = map[string]string{}
+		}
+		event.Details["error"] = err.Error()
+	}
+	helper.RecordAuditEvent(ctx, event)
+}
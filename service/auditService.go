@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var auditCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "audit")
+
+// AuditFilter narrows down ListAuditEvents. Empty fields match everything.
+type AuditFilter struct {
+	Action    string
+	Actor_id  string
+	Target_id string
+	Outcome   string
+	Since     time.Time
+	Until     time.Time
+}
+
+// AuditPage is one page of audit events, newest first. Pass Next_cursor back to get the
+// following page; it is empty on the last page.
+type AuditPage struct {
+	Items       []models.AuditEvent `json:"items"`
+	Next_cursor string              `json:"next_cursor,omitempty"`
+}
+
+// ListAuditEvents returns audit events matching filter, newest first, starting after the
+// event cursor points at. Only ADMINs may read the audit log; API keys need the audit:read
+// scope. limit defaults to 50 and is capped at 500.
+func ListAuditEvents(ctx context.Context, caller helper.Identity, filter AuditFilter, cursor string, limit int) (AuditPage, error) {
+	var page AuditPage
+
+	if err := helper.CheckUserType(caller, "ADMIN"); err != nil {
+		return page, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckScope(caller, "audit:read"); err != nil {
+		return page, &Error{Code: InsufficientScope, Message: err.Error(), Scope: "audit:read"}
+	}
+
+	if limit < 1 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	query := bson.M{}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.Actor_id != "" {
+		query["actor_id"] = filter.Actor_id
+	}
+	if filter.Target_id != "" {
+		query["target_id"] = filter.Target_id
+	}
+	if filter.Outcome != "" {
+		query["outcome"] = filter.Outcome
+	}
+	createdAt := bson.M{}
+	if !filter.Since.IsZero() {
+		createdAt["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		createdAt["$lt"] = filter.Until
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	// Object ids made by different instances don't sort in the order the events happened,
+	// so events are ordered by when they happened and then by id, and the cursor holds both
+	if cursor != "" {
+		createdAt, id, err := parseAuditCursor(cursor)
+		if err != nil {
+			return page, newError(InvalidArgument, "invalid cursor")
+		}
+		query["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": createdAt}},
+			bson.M{"created_at": createdAt, "_id": bson.M{"$lt": id}},
+		}
+	}
+
+	// Read one extra event to know whether there is another page
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+	results, err := auditCollection.Find(ctx, query, opts)
+	if err != nil {
+		return page, newError(Internal, "error occurred while reading the audit log")
+	}
+
+	page.Items = []models.AuditEvent{}
+	if err = results.All(ctx, &page.Items); err != nil {
+		return page, newError(Internal, "error occurred while reading the audit log")
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		page.Next_cursor = auditCursor(page.Items[limit-1])
+	}
+	return page, nil
+}
+
+// auditCursor returns the cursor for the events after event: the time it happened in Unix
+// milliseconds and its object id, such as "1700000000000_65f0c0ffee0123456789abcd".
+func auditCursor(event models.AuditEvent) string {
+	return strconv.FormatInt(event.Created_at.UnixMilli(), 10) + "_" + event.ID.Hex()
+}
+
+// parseAuditCursor parses a cursor made by auditCursor.
+func parseAuditCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	millis, hex, ok := strings.Cut(cursor, "_")
+	if !ok {
+		return time.Time{}, primitive.NilObjectID, errors.New("invalid cursor")
+	}
+	n, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, err
+	}
+	return time.UnixMilli(n).UTC(), id, nil
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var knownDeviceCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "known_device")
+
+// Reasons a login has to be confirmed, listed in LOGIN_STEP_UP separated by commas, or
+// "off". Impossible travel needs GEOIP_DATABASE.
+const (
+	stepUpNewDevice        = "new_device"
+	stepUpImpossibleTravel = "impossible_travel"
+)
+
+// LoginStepUp holds the reasons that make a login confirm itself before getting a session.
+var LoginStepUp = loadLoginStepUp()
+
+// ImpossibleTravelSpeed, set with IMPOSSIBLE_TRAVEL_SPEED in km/h, is the fastest a user is
+// believed to travel between two logins. GeoIP locations are rough, so logins less than
+// impossibleTravelMinKm apart never count.
+var ImpossibleTravelSpeed = helper.GetEnvInt("IMPOSSIBLE_TRAVEL_SPEED", 900)
+
+const impossibleTravelMinKm = 300
+
+func loadLoginStepUp() map[string]bool {
+	reasons := map[string]bool{}
+	value := helper.GetEnv("LOGIN_STEP_UP", stepUpImpossibleTravel)
+	if value == "off" {
+		return reasons
+	}
+	for _, reason := range strings.Split(value, ",") {
+		switch reason = strings.TrimSpace(reason); reason {
+		case stepUpNewDevice, stepUpImpossibleTravel:
+			reasons[reason] = true
+		default:
+			log.Fatal("unknown LOGIN_STEP_UP reason ", reason)
+		}
+	}
+	return reasons
+}
+
+// loginDevice is what a login found out about the device it came from.
+type loginDevice struct {
+	record   models.KnownDevice
+	known    bool // the login came with the device token of one of the user's known devices
+	familiar bool // not known, but it looks like a known device by user agent and network
+	first    bool // the user has never signed in from any device
+	travel   string
+}
+
+// isNew reports whether the user is told about the device, or asked to confirm it.
+func (d loginDevice) isNew() bool {
+	return !d.known && !d.familiar && !d.first
+}
+
+// identifyDevice recognizes the device a login of user comes from by its device token, and
+// checks whether the user could have travelled to it since their last located login. Only
+// the token makes a device known. Without it, a login whose user agent and network match a
+// known device, say from a private window, is familiar: it isn't treated as a new device,
+// but gets nothing else a known device gets, since both are up to the client.
+func identifyDevice(ctx context.Context, user models.User, deviceToken string, userAgent string, ip string) (loginDevice, error) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	device := loginDevice{record: models.KnownDevice{
+		User_id:      user.User_id,
+		Fingerprint:  helper.DeviceFingerprint(userAgent, ip),
+		Device:       helper.DeviceName(userAgent),
+		User_agent:   userAgent,
+		Ip:           ip,
+		Last_seen_at: now,
+	}}
+	if location, ok := helper.LookupLocation(ip); ok {
+		device.record.Located = true
+		device.record.Country, device.record.City = location.Country, location.City
+		device.record.Latitude, device.record.Longitude = location.Latitude, location.Longitude
+	}
+
+	var err error
+	if device.record.Device_id, device.known, err = knownDeviceId(ctx, user.User_id, deviceToken); err != nil {
+		return device, err
+	}
+	if !device.known {
+		count, err := knownDeviceCollection.CountDocuments(ctx, bson.M{"user_id": user.User_id}, options.Count().SetLimit(1))
+		if err != nil {
+			return device, err
+		}
+		device.first = count == 0
+		// A token whose device was forgotten is never honoured again, so the device gets a new id
+		if device.record.Device_id, err = helper.NewDeviceId(); err != nil {
+			return device, err
+		}
+		count, err = knownDeviceCollection.CountDocuments(ctx,
+			bson.M{"user_id": user.User_id, "fingerprint": device.record.Fingerprint}, options.Count().SetLimit(1))
+		if err != nil {
+			return device, err
+		}
+		device.familiar = count > 0
+	}
+
+	if device.record.Located {
+		device.travel, err = checkTravel(ctx, device.record)
+	}
+	return device, err
+}
+
+// knownDeviceId returns the id of the device deviceToken was issued to, when it belongs to
+// userId and the device is still among the user's known devices. The token alone isn't
+// enough: forgetting a device must take away what being known grants, like the exemption
+// from lockouts, from whoever holds its token.
+func knownDeviceId(ctx context.Context, userId string, deviceToken string) (deviceId string, known bool, err error) {
+	deviceId, ok := helper.VerifyDeviceToken(deviceToken, userId)
+	if !ok {
+		return "", false, nil
+	}
+	count, err := knownDeviceCollection.CountDocuments(ctx, bson.M{"user_id": userId, "device_id": deviceId}, options.Count().SetLimit(1))
+	if err != nil {
+		return "", false, err
+	}
+	if count == 0 {
+		return "", false, nil
+	}
+	return deviceId, true, nil
+}
+
+// checkTravel compares the location of a login with the user's last located login and
+// describes the trip when it would have been faster than ImpossibleTravelSpeed.
+func checkTravel(ctx context.Context, current models.KnownDevice) (string, error) {
+	var last models.KnownDevice
+	opts := options.FindOne().SetSort(bson.M{"last_seen_at": -1})
+	err := knownDeviceCollection.FindOne(ctx, bson.M{"user_id": current.User_id, "located": true}, opts).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	distance := helper.DistanceKm(last.Latitude, last.Longitude, current.Latitude, current.Longitude)
+	if distance < impossibleTravelMinKm {
+		return "", nil
+	}
+	hours := current.Last_seen_at.Sub(last.Last_seen_at).Hours()
+	if hours > 0 && distance/hours <= float64(ImpossibleTravelSpeed) {
+		return "", nil
+	}
+	return fmt.Sprintf("%.0f km from %s in %s", distance, placeName(last), current.Last_seen_at.Sub(last.Last_seen_at).Round(time.Minute)), nil
+}
+
+// stepUpReason returns why a login from device has to be confirmed, or an empty string.
+func stepUpReason(device loginDevice) string {
+	switch {
+	case LoginStepUp[stepUpImpossibleTravel] && device.travel != "":
+		return stepUpImpossibleTravel
+	case LoginStepUp[stepUpNewDevice] && device.isNew():
+		return stepUpNewDevice
+	}
+	return ""
+}
+
+// rememberDevice records a completed login from device. The first login from a new device
+// is audited and emailed to the user, unless it is the first device the user ever used or
+// it is familiar.
+func rememberDevice(ctx context.Context, user models.User, device loginDevice) {
+	record := device.record
+	_, err := knownDeviceCollection.UpdateOne(ctx,
+		bson.M{"user_id": user.User_id, "device_id": record.Device_id},
+		bson.M{
+			"$set": bson.M{
+				"fingerprint":  record.Fingerprint,
+				"device":       record.Device,
+				"user_agent":   record.User_agent,
+				"ip":           record.Ip,
+				"located":      record.Located,
+				"country":      record.Country,
+				"city":         record.City,
+				"latitude":     record.Latitude,
+				"longitude":    record.Longitude,
+				"last_seen_at": record.Last_seen_at,
+			},
+			"$setOnInsert": bson.M{"first_seen_at": record.Last_seen_at},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Println("error occurred while remembering a device:", err)
+	}
+	if !device.isNew() {
+		return
+	}
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{
+		Action:    helper.AuditNewDevice,
+		Actor_id:  user.User_id,
+		Target_id: user.User_id,
+		Details:   map[string]string{"device_id": record.Device_id, "device": record.Device, "location": placeName(record)},
+	})
+	if user.Email != nil {
+		helper.SendMailAsync(*user.Email, "New sign-in to your account", fmt.Sprintf(
+			"Your account was just signed in to from a new device.\n\n"+
+				"Device: %s\nIP address: %s\nLocation: %s\nTime: %s\n\n"+
+				"If this was you, there is nothing to do. If it wasn't, change your password and "+
+				"sign out the sessions you don't recognize.\n",
+			record.Device, record.Ip, placeName(record), record.Last_seen_at.Format(time.RFC1123)))
+	}
+}
+
+// placeName describes where device was, or "unknown" when it wasn't located.
+func placeName(device models.KnownDevice) string {
+	switch {
+	case !device.Located:
+		return "unknown"
+	case device.City != "":
+		return device.City + ", " + device.Country
+	case device.Country != "":
+		return device.Country
+	}
+	return fmt.Sprintf("%.2f, %.2f", device.Latitude, device.Longitude)
+}
+
+// ListDevices returns the devices the caller has signed in from, most recently used first.
+func ListDevices(ctx context.Context, caller helper.Identity) ([]models.KnownDevice, error) {
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return nil, newError(PermissionDenied, err.Error())
+	}
+	opts := options.Find().SetSort(bson.M{"last_seen_at": -1})
+	cursor, err := knownDeviceCollection.Find(ctx, bson.M{"user_id": caller.GetString("uid")}, opts)
+	if err != nil {
+		return nil, newError(Internal, "error occurred while listing the devices")
+	}
+	devices := []models.KnownDevice{}
+	if err = cursor.All(ctx, &devices); err != nil {
+		return nil, newError(Internal, "error occurred while listing the devices")
+	}
+	return devices, nil
+}
+
+// ForgetDevice removes deviceId from the caller's known devices. Its device token stops
+// counting, so the next login with it counts as coming from a new device and isn't exempt
+// from lockouts.
+func ForgetDevice(ctx context.Context, caller helper.Identity, deviceId string) error {
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return newError(PermissionDenied, err.Error())
+	}
+	result, err := knownDeviceCollection.DeleteOne(ctx, bson.M{"user_id": caller.GetString("uid"), "device_id": deviceId})
+	if err != nil {
+		return newError(Internal, "error occurred while forgetting the device")
+	}
+	if result.DeletedCount == 0 {
+		return newError(NotFound, "device not found")
+	}
+	return nil
+}
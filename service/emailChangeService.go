@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var emailChangeCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "email_change")
+
+// EmailChangeTTL is how long the confirmation link sent to a new email address works, set
+// with EMAIL_CHANGE_TTL.
+var EmailChangeTTL = helper.GetEnvDuration("EMAIL_CHANGE_TTL", 24*time.Hour)
+
+// EmailChangeUndoTTL is how long the undo link sent to the old email address works, set
+// with EMAIL_CHANGE_UNDO_TTL. It should outlast EmailChangeTTL, so a change confirmed at the
+// last moment can still be undone.
+var EmailChangeUndoTTL = helper.GetEnvDuration("EMAIL_CHANGE_UNDO_TTL", 7*24*time.Hour)
+
+// EmailChangeConfirmURL and EmailChangeUndoURL, set with EMAIL_CHANGE_CONFIRM_URL and
+// EMAIL_CHANGE_UNDO_URL, are the pages that confirm and undo an email change. The token is
+// added to them as the token query parameter.
+var (
+	EmailChangeConfirmURL = helper.GetEnv("EMAIL_CHANGE_CONFIRM_URL", "http://localhost:8080/confirm-email")
+	EmailChangeUndoURL    = helper.GetEnv("EMAIL_CHANGE_UNDO_URL", "http://localhost:8080/undo-email-change")
+)
+
+// RequestEmailChange starts changing the caller's email address to newEmail. A confirmation
+// link goes to the new address and nothing changes until it is used; the old address is
+// told about the request and gets a link that cancels it, or undoes it once confirmed. A
+// new request replaces any pending one.
+func RequestEmailChange(ctx context.Context, caller helper.Identity, newEmail string) (err error) {
+	userId := caller.GetString("uid")
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckNotImpersonating(caller); err != nil {
+		return newError(PermissionDenied, err.Error())
+	}
+	ip := helper.RequestInfoFromContext(ctx).Ip
+	if err := checkRateLimit(ctx, rateLimitEmailChange, ip, caller.GetString("email")); err != nil {
+		return err
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	defer func() {
+		audit(ctx, models.AuditEvent{
+			Action:    helper.AuditEmailChangeRequested,
+			Actor_id:  userId,
+			Target_id: userId,
+			Details:   map[string]string{"new_email": newEmail},
+		}, err)
+	}()
+
+	if err := validate.Var(newEmail, "required,email"); err != nil {
+		return newError(InvalidArgument, "email must be a valid email address")
+	}
+	user, err := loadUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if msg := helper.CheckUserStatus(user); msg != "" {
+		return newError(PermissionDenied, msg)
+	}
+	if user.Email == nil {
+		return newError(InvalidArgument, "the account has no email address")
+	}
+	if *user.Email == newEmail {
+		return newError(InvalidArgument, "this is already the account's email address")
+	}
+	if err := checkEmailAvailable(ctx, newEmail); err != nil {
+		return err
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		return newError(Internal, "error occurred while creating the confirmation link")
+	}
+	undoToken, err := generateResetToken()
+	if err != nil {
+		return newError(Internal, "error occurred while creating the confirmation link")
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	change := models.EmailChange{
+		ID:              primitive.NewObjectID(),
+		Token_hash:      helper.HashToken(token),
+		Undo_token_hash: helper.HashToken(undoToken),
+		User_id:         userId,
+		Old_email:       *user.Email,
+		New_email:       newEmail,
+		Ip:              ip,
+		Created_at:      now,
+		Expires_at:      now.Add(EmailChangeTTL),
+		Undo_expires_at: now.Add(EmailChangeUndoTTL),
+	}
+	emailChangeCollection.UpdateMany(ctx, pendingEmailChange(bson.M{"user_id": userId}), bson.M{"$set": bson.M{"cancelled_at": now}})
+	if _, err := emailChangeCollection.InsertOne(ctx, change); err != nil {
+		return newError(Internal, "error occurred while creating the confirmation link")
+	}
+
+	helper.SendMailAsync(newEmail, "Confirm your new email address",
+		"Someone asked to use this address for their account. To confirm it, open\n\n"+
+			EmailChangeConfirmURL+"?token="+url.QueryEscape(token)+"\n\n"+
+			"The link works once and expires in "+EmailChangeTTL.String()+". "+
+			"If you didn't ask for it, you can ignore this email.\n")
+	helper.SendMailAsync(change.Old_email, "Your email address is being changed",
+		"Someone asked to change the email address of your account to "+newEmail+". "+
+			"It changes once the new address is confirmed.\n\n"+
+			"If this wasn't you, open the link below to cancel the change, or to undo it if it has "+
+			"already been made, and then change your password:\n\n"+
+			EmailChangeUndoURL+"?token="+url.QueryEscape(undoToken)+"\n\n"+
+			"The link expires in "+EmailChangeUndoTTL.String()+".\n")
+	return nil
+}
+
+// ConfirmEmailChange makes the email change a confirmation link was sent for. The token works
+// once, and only while the account still has the address the change started from. Every
+// session of the user is signed out, since their tokens carry the old address.
+func ConfirmEmailChange(ctx context.Context, token string) (err error) {
+	if err := checkRateLimit(ctx, rateLimitEmailChange, helper.RequestInfoFromContext(ctx).Ip, ""); err != nil {
+		return err
+	}
+
+	invalid := newError(InvalidArgument, "the confirmation link is invalid or has expired")
+	var change models.EmailChange
+	tokenFilter := pendingEmailChange(bson.M{"token_hash": helper.HashToken(token), "expires_at": bson.M{"$gt": time.Now()}})
+	if err := emailChangeCollection.FindOne(ctx, tokenFilter).Decode(&change); err != nil {
+		return invalid
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{
+			Action:    helper.AuditEmailChanged,
+			Actor_id:  change.User_id,
+			Target_id: change.User_id,
+			Details:   map[string]string{"old_email": change.Old_email, "new_email": change.New_email},
+		}, err)
+	}()
+
+	user, err := loadUser(ctx, change.User_id)
+	if err != nil {
+		return invalid
+	}
+	if msg := helper.CheckUserStatus(user); msg != "" {
+		return newError(PermissionDenied, msg)
+	}
+
+	// Use up the token first, so the undo link and a second confirmation can't race the change
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result, err := emailChangeCollection.UpdateOne(ctx, tokenFilter, bson.M{"$set": bson.M{"confirmed_at": now}})
+	if err != nil {
+		return newError(Internal, "error occurred while changing the email address")
+	}
+	if result.ModifiedCount == 0 {
+		return invalid
+	}
+
+	if err := setEmail(ctx, change.User_id, change.Old_email, change.New_email); err != nil {
+		emailChangeCollection.UpdateOne(ctx, bson.M{"_id": change.ID}, bson.M{
+			"$set":   bson.M{"cancelled_at": now},
+			"$unset": bson.M{"confirmed_at": ""},
+		})
+		return err
+	}
+	if _, err := helper.RevokeSessions(change.User_id, bson.M{}); err != nil {
+		return newError(Internal, "error occurred while signing out the user's sessions")
+	}
+	helper.SendMailAsync(change.New_email, "Your email address has been changed",
+		"This is now the email address of your account. Sign in with it from now on.\n")
+	return nil
+}
+
+// UndoEmailChange cancels the email change an undo link was sent for, or changes the address
+// back when the change was already made. Someone who was able to request the change may
+// hold a session, so undoing a made change signs every session of the user out.
+func UndoEmailChange(ctx context.Context, token string) (err error) {
+	if err := checkRateLimit(ctx, rateLimitEmailChange, helper.RequestInfoFromContext(ctx).Ip, ""); err != nil {
+		return err
+	}
+
+	invalid := newError(InvalidArgument, "the undo link is invalid or has expired")
+	var change models.EmailChange
+	tokenFilter := bson.M{"undo_token_hash": helper.HashToken(token), "undone_at": nil, "undo_expires_at": bson.M{"$gt": time.Now()}}
+	if err := emailChangeCollection.FindOne(ctx, tokenFilter).Decode(&change); err != nil {
+		return invalid
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{
+			Action:    helper.AuditEmailChangeUndone,
+			Actor_id:  change.User_id,
+			Target_id: change.User_id,
+			Details:   map[string]string{"old_email": change.Old_email, "new_email": change.New_email},
+		}, err)
+	}()
+
+	// Cancel the change if it is still pending, which also stops a confirmation racing the undo
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result, err := emailChangeCollection.UpdateOne(ctx, pendingEmailChange(bson.M{"_id": change.ID}), bson.M{"$set": bson.M{"cancelled_at": now, "undone_at": now}})
+	if err != nil {
+		return newError(Internal, "error occurred while undoing the email change")
+	}
+	if result.ModifiedCount > 0 {
+		return nil
+	}
+
+	result, err = emailChangeCollection.UpdateOne(ctx, bson.M{"_id": change.ID, "undone_at": nil, "confirmed_at": bson.M{"$ne": nil}}, bson.M{"$set": bson.M{"undone_at": now}})
+	if err != nil {
+		return newError(Internal, "error occurred while undoing the email change")
+	}
+	if result.ModifiedCount == 0 {
+		// The change was cancelled without being made, by a newer request or a failed confirmation
+		return nil
+	}
+	if err := setEmail(ctx, change.User_id, change.New_email, change.Old_email); err != nil {
+		emailChangeCollection.UpdateOne(ctx, bson.M{"_id": change.ID}, bson.M{"$unset": bson.M{"undone_at": ""}})
+		return err
+	}
+	if _, err := helper.RevokeSessions(change.User_id, bson.M{}); err != nil {
+		return newError(Internal, "error occurred while signing out the user's sessions")
+	}
+	return nil
+}
+
+// setEmail changes the email address of the user with userId from oldEmail to newEmail. The
+// unique index on email makes the change fail when another account took newEmail since it
+// was checked, and it fails as well when the user's address is no longer oldEmail.
+func setEmail(ctx context.Context, userId string, oldEmail string, newEmail string) error {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"user_id": userId, "email": oldEmail},
+		bson.M{"$set": bson.M{"email": newEmail, "updated_at": now}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return newError(AlreadyExists, "this email address is already used by another account")
+	}
+	if err != nil {
+		return newError(Internal, "error occurred while changing the email address")
+	}
+	if result.MatchedCount == 0 {
+		return newError(InvalidArgument, "the account's email address has changed since; request the change again")
+	}
+	return nil
+}
+
+// checkEmailAvailable fails when email already belongs to an account.
+func checkEmailAvailable(ctx context.Context, email string) error {
+	count, err := userCollection.CountDocuments(ctx, bson.M{"email": email})
+	if err != nil {
+		return newError(Internal, "error occurred while checking for the email address")
+	}
+	if count > 0 {
+		return newError(AlreadyExists, "this email address is already used by another account")
+	}
+	return nil
+}
+
+// pendingEmailChange narrows filter to email changes that were neither made nor cancelled.
+func pendingEmailChange(filter bson.M) bson.M {
+	filter["confirmed_at"] = nil
+	filter["cancelled_at"] = nil
+	return filter
+}
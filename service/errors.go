@@ -0,0 +1,50 @@
+// Package service holds the user and authentication logic shared by the HTTP handlers in
+// controller and the gRPC server in grpcserver. It knows nothing about either transport.
+package service
+
+import "time"
+
+// Code classifies an Error so each transport can map it to its own status codes.
+type Code int
+
+const (
+	InvalidArgument Code = iota + 1
+	Unauthenticated
+	PermissionDenied
+	InsufficientScope
+	NotFound
+	AlreadyExists
+	Internal
+	ResourceExhausted
+	PasswordExpired
+	StepUpRequired
+)
+
+// Error is returned by every service function for failures the caller should see.
+type Error struct {
+	Code    Code
+	Message string
+	Scope   string // the missing scope, set with InsufficientScope
+
+	Retry_after  time.Duration // how long to wait, set with ResourceExhausted
+	Change_token string        // for ChangeExpiredPassword, set with PasswordExpired
+
+	// The login challenge to complete with VerifyLogin and the methods that can complete
+	// it, set with StepUpRequired
+	Challenge_token   string
+	Challenge_methods []string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// RetryAfterSeconds returns Retry_after rounded up to whole seconds, as the Retry-After
+// header needs.
+func (e *Error) RetryAfterSeconds() int64 {
+	return int64((e.Retry_after + time.Second - 1) / time.Second)
+}
+
+func newError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
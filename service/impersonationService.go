@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ImpersonationTTL is how long an impersonation token lasts. Set with IMPERSONATION_TTL.
+var ImpersonationTTL = helper.GetEnvDuration("IMPERSONATION_TTL", 15*time.Minute)
+
+// Impersonation is a token that lets an ADMIN act as another user.
+type Impersonation struct {
+	Token      string    `json:"token"`
+	Token_type string    `json:"token_type"`
+	Expires_at time.Time `json:"expires_at"`
+	Session_id string    `json:"session_id"`
+}
+
+// Impersonate issues a short-lived access token for userId whose act claim names the
+// calling ADMIN. Only ADMINs on their own interactive session may impersonate, only active
+// USER accounts can be impersonated, and the reason is written to the audit log.
+func Impersonate(ctx context.Context, caller helper.Identity, userId string, reason string, userAgent string, ip string) (Impersonation, error) {
+	var result Impersonation
+
+	if err := helper.CheckUserType(caller, "ADMIN"); err != nil {
+		return result, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return result, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckNotImpersonating(caller); err != nil {
+		return result, newError(PermissionDenied, err.Error())
+	}
+	if reason == "" {
+		return result, newError(InvalidArgument, "a reason is required")
+	}
+	if caller.GetString("uid") == userId {
+		return result, newError(InvalidArgument, "you can't impersonate yourself")
+	}
+
+	var user models.User
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return result, newError(NotFound, "user not found")
+	}
+	if err != nil {
+		return result, newError(Internal, err.Error())
+	}
+	if *user.User_type != "USER" {
+		return result, newError(PermissionDenied, "only USER accounts can be impersonated")
+	}
+	if msg := helper.CheckUserStatus(user); msg != "" {
+		return result, newError(PermissionDenied, msg)
+	}
+
+	actor := helper.Actor{Sub: caller.GetString("uid"), Email: caller.GetString("email")}
+	session, err := helper.CreateImpersonationSession(user.User_id, actor.Sub, userAgent, ip, ImpersonationTTL)
+	if err != nil {
+		return result, newError(Internal, "error occurred while creating the session")
+	}
+
+	token, err := helper.GenerateImpersonationToken(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id, session.Session_id, actor, ImpersonationTTL)
+	if err != nil {
+		return result, newError(Internal, "error occurred while signing the token")
+	}
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{
+		Action:    helper.AuditImpersonation,
+		Actor_id:  actor.Sub,
+		Target_id: user.User_id,
+		Details: map[string]string{
+			"reason":     reason,
+			"session_id": session.Session_id,
+			"expires_at": session.Expires_at.Format(time.RFC3339),
+		},
+	})
+
+	result = Impersonation{
+		Token:      token,
+		Token_type: "Bearer",
+		Expires_at: session.Expires_at,
+		Session_id: session.Session_id,
+	}
+	return result, nil
+}
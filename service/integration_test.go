@@ -0,0 +1,65 @@
+//go:build integration
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The tests built with the integration tag run against the MongoDB in MONGODB_URL, with
+// SECRET_KEY set, and are skipped when the database can't be reached:
+//
+//	MONGODB_URL=mongodb://localhost:27017 SECRET_KEY=... go test -tags integration ./...
+
+// requireDatabase skips the test unless the database answers.
+func requireDatabase(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := database.Client.Ping(ctx, nil); err != nil {
+		t.Skip("MongoDB is not reachable:", err)
+	}
+}
+
+// newTestUser stores an active USER with password, whose password was set at
+// passwordChangedAt, and removes the user and their sessions after the test.
+func newTestUser(t *testing.T, password string, passwordChangedAt time.Time) models.User {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	id := primitive.NewObjectID()
+	email := id.Hex() + "@example.com"
+	firstName, lastName, phone, userType := "Test", "User", id.Hex(), "USER"
+	user := models.User{
+		ID:                  id,
+		First_name:          &firstName,
+		Last_name:           &lastName,
+		Password:            &hash,
+		Email:               &email,
+		Phone:               &phone,
+		User_type:           &userType,
+		Created_at:          passwordChangedAt,
+		Updated_at:          passwordChangedAt,
+		User_id:             id.Hex(),
+		Status:              models.UserActive,
+		Password_changed_at: &passwordChangedAt,
+	}
+	ctx := context.Background()
+	if _, err := userCollection.InsertOne(ctx, user); err != nil {
+		t.Fatalf("inserting the test user: %v", err)
+	}
+	t.Cleanup(func() {
+		userCollection.DeleteOne(ctx, bson.M{"user_id": user.User_id})
+		database.OpenCollection(database.Client, "auth", "session").DeleteMany(ctx, bson.M{"user_id": user.User_id})
+	})
+	return user
+}
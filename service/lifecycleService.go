@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DeletedUserRetention is how long a soft-deleted user is kept, and can be reactivated,
+// before PurgeDeletedUsers removes it for good. Set with DELETED_USER_RETENTION.
+var DeletedUserRetention = helper.GetEnvDuration("DELETED_USER_RETENTION", 30*24*time.Hour)
+
+var sessionCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "session")
+
+// statusActions maps each status an ADMIN can set to the statuses it can be set from
+// and the audit action recorded for it.
+var statusActions = map[string]struct {
+	from   []string
+	action string
+}{
+	models.UserSuspended: {[]string{models.UserActive, models.UserPending}, helper.AuditUserSuspended},
+	models.UserActive:    {[]string{models.UserSuspended, models.UserPending, models.UserDeleted}, helper.AuditUserReactivated},
+	models.UserDeleted:   {[]string{models.UserActive, models.UserSuspended, models.UserPending}, helper.AuditUserDeleted},
+}
+
+// SetUserStatus suspends, reactivates or soft-deletes userId. Only ADMINs on an interactive
+// session may change a status, never their own, and a reason is required so the audit log
+// explains every change. Suspended and deleted users are signed out everywhere.
+func SetUserStatus(ctx context.Context, caller helper.Identity, userId string, status string, reason string) (models.User, error) {
+	var user models.User
+
+	if err := helper.CheckUserType(caller, "ADMIN"); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckNotImpersonating(caller); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if caller.GetString("uid") == userId {
+		return user, newError(PermissionDenied, "you can't change the status of your own account")
+	}
+	transition, ok := statusActions[status]
+	if !ok {
+		return user, newError(InvalidArgument, "unknown status "+status)
+	}
+	if reason == "" {
+		return user, newError(InvalidArgument, "a reason is required")
+	}
+
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, newError(NotFound, "user not found")
+	}
+	if err != nil {
+		return user, newError(Internal, err.Error())
+	}
+	sanitize(&user)
+
+	previous := user.CurrentStatus()
+	allowed := false
+	for _, from := range transition.from {
+		allowed = allowed || from == previous
+	}
+	if !allowed {
+		return user, newError(InvalidArgument, "a "+previous+" user can't be set to "+status)
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	set := bson.M{"status": status, "status_reason": reason, "updated_at": now}
+	update := bson.M{"$set": set}
+	if status == models.UserDeleted {
+		set["deleted_at"] = now
+		user.Deleted_at = &now
+	} else {
+		update["$unset"] = bson.M{"deleted_at": ""}
+		user.Deleted_at = nil
+	}
+	if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, update); err != nil {
+		return user, newError(Internal, "error occurred while changing the user's status")
+	}
+	user.Status = status
+	user.Status_reason = reason
+	user.Updated_at = now
+
+	if status != models.UserActive {
+		helper.RevokeSessions(userId, bson.M{})
+	}
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{
+		Action:    transition.action,
+		Actor_id:  caller.GetString("uid"),
+		Target_id: userId,
+		Details:   map[string]string{"from": previous, "to": status, "reason": reason},
+	})
+	return user, nil
+}
+
+// PurgeDeletedUsers permanently removes users that were soft-deleted more than
+// DeletedUserRetention ago, together with their sessions and API keys. It returns how
+// many users were removed.
+func PurgeDeletedUsers(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-DeletedUserRetention)
+	cursor, err := userCollection.Find(ctx, bson.M{"status": models.UserDeleted, "deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return 0, err
+	}
+	var users []models.User
+	if err = cursor.All(ctx, &users); err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for _, user := range users {
+		// Only delete the user if it is still deleted, in case it was reactivated meanwhile
+		result, err := userCollection.DeleteOne(ctx, bson.M{"user_id": user.User_id, "status": models.UserDeleted})
+		if err != nil {
+			return purged, err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		if _, err := sessionCollection.DeleteMany(ctx, bson.M{"user_id": user.User_id}); err != nil {
+			return purged, err
+		}
+		if _, err := apiKeyCollection.DeleteMany(ctx, bson.M{"user_id": user.User_id}); err != nil {
+			return purged, err
+		}
+		purged++
+		helper.RecordAuditEvent(ctx, models.AuditEvent{Action: helper.AuditUserPurged, Actor_id: "system", Target_id: user.User_id})
+	}
+	return purged, nil
+}
+
+// RunPurge calls PurgeDeletedUsers every interval until ctx is done, logging failures.
+func RunPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purgeCtx, cancel := context.WithTimeout(ctx, 100*time.Second)
+		if purged, err := PurgeDeletedUsers(purgeCtx); err != nil {
+			log.Println("error occurred while purging deleted users:", err)
+		} else if purged > 0 {
+			log.Println("purged", purged, "deleted users")
+		}
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
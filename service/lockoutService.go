@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Lockout settings. After LOGIN_BACKOFF_AFTER failed logins each further attempt has to
+// wait twice as long as the one before, starting at LOGIN_BACKOFF_BASE and capped at
+// LOGIN_BACKOFF_MAX. LOCKOUT_THRESHOLD failures lock the account for LOCKOUT_DURATION, after
+// which it unlocks by itself. Failures older than LOCKOUT_WINDOW are forgotten. Only logins
+// from devices the user hasn't signed in from before count; a threshold of 0 turns
+// lockouts off.
+var (
+	LockoutThreshold = helper.GetEnvInt("LOCKOUT_THRESHOLD", 10)
+	LockoutDuration  = helper.GetEnvDuration("LOCKOUT_DURATION", 15*time.Minute)
+	LockoutWindow    = helper.GetEnvDuration("LOCKOUT_WINDOW", time.Hour)
+	LoginBackoffFrom = helper.GetEnvInt("LOGIN_BACKOFF_AFTER", 3)
+	LoginBackoffBase = helper.GetEnvDuration("LOGIN_BACKOFF_BASE", time.Second)
+	LoginBackoffMax  = helper.GetEnvDuration("LOGIN_BACKOFF_MAX", time.Minute)
+)
+
+// loginBackoff returns how long after the last of failures failed logins the next attempt
+// has to wait.
+func loginBackoff(failures int) time.Duration {
+	if failures < LoginBackoffFrom {
+		return 0
+	}
+	delay := LoginBackoffBase
+	for i := LoginBackoffFrom; i < failures && delay < LoginBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > LoginBackoffMax {
+		delay = LoginBackoffMax
+	}
+	return delay
+}
+
+// checkLockout returns an error when user is locked out, or must wait before trying again,
+// at now.
+func checkLockout(user models.User, now time.Time) error {
+	if LockoutThreshold <= 0 {
+		return nil
+	}
+	if user.Lockout_until != nil && now.Before(*user.Lockout_until) {
+		return &Error{
+			Code:        ResourceExhausted,
+			Message:     "this account is temporarily locked after too many failed logins",
+			Retry_after: user.Lockout_until.Sub(now),
+		}
+	}
+	if user.Last_failed_login == nil || now.Sub(*user.Last_failed_login) > LockoutWindow {
+		return nil
+	}
+	if retryAt := user.Last_failed_login.Add(loginBackoff(user.Failed_logins)); now.Before(retryAt) {
+		return &Error{
+			Code:        ResourceExhausted,
+			Message:     "too many failed logins, try again later",
+			Retry_after: retryAt.Sub(now),
+		}
+	}
+	return nil
+}
+
+// recordFailedLogin counts a failed login for user and locks the account once the failures
+// reach LockoutThreshold, emailing the user about it.
+func recordFailedLogin(ctx context.Context, user models.User) {
+	if LockoutThreshold <= 0 {
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	// Start counting again when the previous failure is outside the window
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failed_logins": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$last_failed_login", now.Add(-LockoutWindow)}},
+			bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failed_logins", 0}}, 1}},
+			1,
+		}},
+		"last_failed_login": now,
+	}}}}
+	if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": user.User_id}, update); err != nil {
+		log.Println("error occurred while counting a failed login:", err)
+		return
+	}
+
+	// Only the attempt that crosses the threshold locks the account and sends the email
+	until := now.Add(LockoutDuration)
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"user_id": user.User_id, "failed_logins": bson.M{"$gte": LockoutThreshold}},
+		bson.M{"$set": bson.M{"lockout_until": until, "failed_logins": 0}},
+	)
+	if err != nil {
+		log.Println("error occurred while locking out a user:", err)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		return
+	}
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{
+		Action:    helper.AuditUserLockedOut,
+		Actor_id:  "system",
+		Target_id: user.User_id,
+		Details:   map[string]string{"until": until.Format(time.RFC3339)},
+	})
+	if user.Email != nil {
+		helper.SendMailAsync(*user.Email, "Your account has been locked", fmt.Sprintf(
+			"There were %d failed attempts to sign in to your account, so it has been locked until %s.\n\n"+
+				"You can still sign in from devices you have used before. If this wasn't you, "+
+				"consider changing your password once you are signed in.\n",
+			LockoutThreshold, until.Format(time.RFC1123)))
+	}
+}
+
+// clearFailedLogins forgets the failed logins of user after a successful one.
+func clearFailedLogins(ctx context.Context, user models.User) {
+	if user.Failed_logins == 0 && user.Last_failed_login == nil && user.Lockout_until == nil {
+		return
+	}
+	_, err := userCollection.UpdateOne(ctx, bson.M{"user_id": user.User_id}, bson.M{
+		"$unset": bson.M{"failed_logins": "", "last_failed_login": "", "lockout_until": ""},
+	})
+	if err != nil {
+		log.Println("error occurred while clearing failed logins:", err)
+	}
+}
+
+// UnlockAccount lifts both an ADMIN lock and a lockout after failed logins from userId.
+// Only ADMINs on an interactive session may unlock accounts.
+func UnlockAccount(ctx context.Context, caller helper.Identity, userId string) (models.User, error) {
+	var user models.User
+
+	if err := helper.CheckUserType(caller, "ADMIN"); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckNotImpersonating(caller); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+
+	if err := unlockUser(ctx, caller.GetString("uid"), userId); err != nil {
+		return user, err
+	}
+
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		return user, newError(Internal, "error occurred while loading the user")
+	}
+	sanitize(&user)
+	return user, nil
+}
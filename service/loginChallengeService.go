@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var loginChallengeCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "login_challenge")
+
+// Methods that complete a login challenge: a code emailed to the user, or a code from the
+// authenticator app they set up with EnrollTOTP.
+const (
+	StepUpEmail = "email"
+	StepUpTOTP  = "totp"
+)
+
+// LoginStepUpMethod, set with LOGIN_STEP_UP_METHOD, decides how a challenged login is
+// confirmed: "email" only takes the emailed code, "mfa" only takes the authenticator app,
+// and "any", the default, takes either. Users without an authenticator app always get the
+// emailed code, so "mfa" can't shut them out.
+var LoginStepUpMethod = loadLoginStepUpMethod()
+
+func loadLoginStepUpMethod() string {
+	method := helper.GetEnv("LOGIN_STEP_UP_METHOD", "any")
+	switch method {
+	case "any", "mfa", "email":
+	default:
+		log.Fatal("unknown LOGIN_STEP_UP_METHOD ", method)
+	}
+	return method
+}
+
+// LoginChallengeTTL is how long a challenged login can be completed, set with LOGIN_CHALLENGE_TTL.
+var LoginChallengeTTL = helper.GetEnvDuration("LOGIN_CHALLENGE_TTL", 10*time.Minute)
+
+// loginChallengeAttempts is how many wrong codes a challenge takes before it stops working.
+const loginChallengeAttempts = 5
+
+// stepUpMethods returns the methods that can confirm a login of user.
+func stepUpMethods(user models.User) []string {
+	if user.Totp_secret == "" {
+		return []string{StepUpEmail}
+	}
+	switch LoginStepUpMethod {
+	case "mfa":
+		return []string{StepUpTOTP}
+	case "email":
+		return []string{StepUpEmail}
+	}
+	return []string{StepUpTOTP, StepUpEmail}
+}
+
+// startLoginChallenge holds back the login of user from device until it is confirmed, and
+// returns the StepUpRequired error that hands the challenge to the client. When the
+// emailed code can confirm it, the code is sent right away.
+func startLoginChallenge(ctx context.Context, user models.User, device loginDevice, reason string) error {
+	token, err := generateResetToken()
+	if err != nil {
+		return newError(Internal, "error occurred while creating the login challenge")
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	challenge := models.LoginChallenge{
+		ID:         primitive.NewObjectID(),
+		Token_hash: helper.HashToken(token),
+		User_id:    user.User_id,
+		Methods:    stepUpMethods(user),
+		Reason:     reason,
+		Device:     device.record,
+		New_device: device.isNew(),
+		Created_at: now,
+		Expires_at: now.Add(LoginChallengeTTL),
+	}
+
+	code := ""
+	for _, method := range challenge.Methods {
+		if method == StepUpEmail {
+			if code, err = generateLoginCode(); err != nil {
+				return newError(Internal, "error occurred while creating the login challenge")
+			}
+			challenge.Code_hash = loginCodeHash(token, code)
+		}
+	}
+	if _, err := loginChallengeCollection.InsertOne(ctx, challenge); err != nil {
+		return newError(Internal, "error occurred while creating the login challenge")
+	}
+
+	if code != "" && user.Email != nil {
+		why := "from a device you haven't used before"
+		if reason == stepUpImpossibleTravel {
+			why = "from a place you couldn't have reached since your last sign-in (" + device.travel + ")"
+		}
+		helper.SendMailAsync(*user.Email, "Confirm your sign-in", fmt.Sprintf(
+			"Someone signed in to your account %s.\n\n"+
+				"Device: %s\nIP address: %s\nLocation: %s\n\n"+
+				"If it was you, enter this code to finish signing in: %s\n\n"+
+				"The code expires in %s. If it wasn't you, don't share the code and change your password.\n",
+			why, device.record.Device, device.record.Ip, placeName(device.record), code, LoginChallengeTTL))
+	}
+
+	return &Error{
+		Code:              StepUpRequired,
+		Message:           "this sign-in has to be confirmed",
+		Challenge_token:   token,
+		Challenge_methods: challenge.Methods,
+	}
+}
+
+// VerifyLogin completes a login challenge with code, from the emailed message or the
+// authenticator app as method says, and then signs in like Login. A challenge works once
+// and stops working after a few wrong codes.
+func VerifyLogin(ctx context.Context, challengeToken string, method string, code string) (user models.User, newDeviceToken string, err error) {
+	if err := checkRateLimit(ctx, rateLimitLoginVerify, helper.RequestInfoFromContext(ctx).Ip, ""); err != nil {
+		return user, "", err
+	}
+
+	invalid := newError(Unauthenticated, "the login challenge is invalid or has expired; sign in again")
+	var challenge models.LoginChallenge
+	filter := bson.M{"token_hash": helper.HashToken(challengeToken), "used_at": nil, "expires_at": bson.M{"$gt": time.Now()}}
+	if err := loginChallengeCollection.FindOne(ctx, filter).Decode(&challenge); err != nil {
+		return user, "", invalid
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{
+			Action:    helper.AuditLoginVerified,
+			Actor_id:  challenge.User_id,
+			Target_id: challenge.User_id,
+			Details:   map[string]string{"method": method, "reason": challenge.Reason},
+		}, err)
+	}()
+
+	allowed := false
+	for _, m := range challenge.Methods {
+		allowed = allowed || m == method
+	}
+	if !allowed {
+		return user, "", newError(InvalidArgument, "this login can't be confirmed with "+method)
+	}
+
+	// Count the attempt before checking the code, so parallel guesses share the budget
+	result, err := loginChallengeCollection.UpdateOne(ctx,
+		bson.M{"_id": challenge.ID, "used_at": nil, "attempts": bson.M{"$lt": loginChallengeAttempts}},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+	)
+	if err != nil {
+		return user, "", newError(Internal, "error occurred while checking the code")
+	}
+	if result.ModifiedCount == 0 {
+		return user, "", newError(Unauthenticated, "too many wrong codes; sign in again")
+	}
+
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": challenge.User_id}).Decode(&user); err != nil {
+		return user, "", invalid
+	}
+	if msg := helper.CheckUserStatus(user); msg != "" {
+		return user, "", newError(PermissionDenied, msg)
+	}
+
+	var amr []string
+	switch method {
+	case StepUpEmail:
+		if subtle.ConstantTimeCompare([]byte(loginCodeHash(challengeToken, code)), []byte(challenge.Code_hash)) != 1 {
+			return user, "", newError(Unauthenticated, "the code is incorrect")
+		}
+		amr = []string{helper.AmrPassword, helper.AmrEmail}
+	case StepUpTOTP:
+		if err := checkTOTP(ctx, user, code); err != nil {
+			return user, "", err
+		}
+		amr = []string{helper.AmrPassword, helper.AmrOTP, helper.AmrMFA}
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result, err = loginChallengeCollection.UpdateOne(ctx, bson.M{"_id": challenge.ID, "used_at": nil}, bson.M{"$set": bson.M{"used_at": now}})
+	if err != nil {
+		return user, "", newError(Internal, "error occurred while completing the login")
+	}
+	if result.ModifiedCount == 0 {
+		return user, "", invalid
+	}
+
+	// The session is for the client completing the challenge, which may differ from the one
+	// that entered the password only in its address
+	// Only whether the device is new matters once the login is confirmed
+	device := loginDevice{record: challenge.Device, familiar: !challenge.New_device}
+	if info := helper.RequestInfoFromContext(ctx); info.Ip != "" {
+		device.record.Ip = info.Ip
+	}
+	device.record.Last_seen_at = now
+	return completeLogin(ctx, user, device, amr)
+}
+
+// generateLoginCode returns a random 6 digit code.
+func generateLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// loginCodeHash binds an emailed code to its challenge, so a copy of the stored hashes
+// can't be searched for the code without the challenge token.
+func loginCodeHash(challengeToken string, code string) string {
+	return helper.HashToken(challengeToken + ":" + code)
+}
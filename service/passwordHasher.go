@@ -0,0 +1,84 @@
+package service
+
+import (
+	"log"
+	"runtime"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/passwordhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordHashers hashes new passwords with PASSWORD_HASHER, one of argon2id (the default),
+// scrypt and bcrypt, and still verifies hashes made with the others. Their parameters are
+// set with ARGON2_TIME, ARGON2_MEMORY (KiB) and ARGON2_THREADS, SCRYPT_LN, SCRYPT_R and
+// SCRYPT_P, and BCRYPT_COST. A user whose hash uses another algorithm or weaker parameters
+// is moved to the current ones the next time they sign in. A parameter out of its range
+// stops the service at startup.
+//
+// dummyPasswordHash is a hash from the current hasher that logins for unknown emails are
+// checked against, so they take as long as logins for registered ones.
+var passwordHashers, dummyPasswordHash = loadPasswordHashers()
+
+// passwordHashSlots bounds how many passwords are hashed or verified at once, set with
+// PASSWORD_HASH_CONCURRENCY and defaulting to the number of CPUs. Each Argon2id hash holds
+// ARGON2_MEMORY while it runs, so a burst of logins and signups waits for a slot instead of
+// running the process out of memory.
+var passwordHashSlots = make(chan struct{}, loadPasswordHashConcurrency())
+
+func loadPasswordHashConcurrency() int {
+	concurrency := helper.GetEnvInt("PASSWORD_HASH_CONCURRENCY", runtime.NumCPU())
+	if concurrency < 1 {
+		log.Fatal("PASSWORD_HASH_CONCURRENCY must be at least 1")
+	}
+	return concurrency
+}
+
+func loadPasswordHashers() (*passwordhash.Hashers, string) {
+	// Out of range values would wrap around in the conversions below, or make every hash fail
+	argon2Threads := envIntInRange("ARGON2_THREADS", 4, 1, 255)
+	argon2 := passwordhash.Argon2id{
+		Time:    uint32(envIntInRange("ARGON2_TIME", 3, 1, 100)),
+		Memory:  uint32(envIntInRange("ARGON2_MEMORY", 64*1024, 8*argon2Threads, passwordhash.MaxArgon2Memory)),
+		Threads: uint8(argon2Threads),
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+	scrypt := passwordhash.Scrypt{
+		LogN:    envIntInRange("SCRYPT_LN", 15, 2, 30),
+		R:       envIntInRange("SCRYPT_R", 8, 1, passwordhash.MaxScryptMemory/128),
+		P:       envIntInRange("SCRYPT_P", 1, 1, passwordhash.MaxScryptP),
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+	if 128*(int64(1)<<scrypt.LogN)*int64(scrypt.R) > passwordhash.MaxScryptMemory {
+		log.Fatalf("SCRYPT_LN and SCRYPT_R need more than %d bytes of memory per hash", passwordhash.MaxScryptMemory)
+	}
+	hashers := map[string]passwordhash.PasswordHasher{
+		"argon2id": argon2,
+		"scrypt":   scrypt,
+		"bcrypt":   passwordhash.Bcrypt{Cost: envIntInRange("BCRYPT_COST", 14, bcrypt.MinCost, bcrypt.MaxCost)},
+	}
+
+	name := helper.GetEnv("PASSWORD_HASHER", "argon2id")
+	current, ok := hashers[name]
+	if !ok {
+		log.Fatal("unknown PASSWORD_HASHER ", name)
+	}
+	// Check the parameters now rather than on the first signup
+	dummy, err := current.Hash("check")
+	if err != nil {
+		log.Fatal("invalid ", name, " parameters: ", err)
+	}
+	return passwordhash.NewHashers(current, hashers["argon2id"], hashers["scrypt"], hashers["bcrypt"]), dummy
+}
+
+// envIntInRange returns the environment variable key as GetEnvInt does, and stops the
+// service when it is outside min..max.
+func envIntInRange(key string, fallback int, min int, max int) int {
+	value := helper.GetEnvInt(key, fallback)
+	if value < min || value > max {
+		log.Fatalf("%s must be between %d and %d", key, min, max)
+	}
+	return value
+}
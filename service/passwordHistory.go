@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PasswordHistorySize is how many previous passwords of a user can't be chosen again,
+// set with PASSWORD_HISTORY. 0 only refuses the current password.
+var PasswordHistorySize = helper.GetEnvInt("PASSWORD_HISTORY", 5)
+
+// PasswordMaxAge, set with PASSWORD_MAX_AGE, is how long a password can be used before it
+// has to be changed. Logins with an older password get a password change token instead of
+// a session. 0, the default, lets passwords live forever.
+var PasswordMaxAge = helper.GetEnvDuration("PASSWORD_MAX_AGE", 0)
+
+// PasswordChangeTokenTTL is how long the token for changing an expired password works, set
+// with PASSWORD_CHANGE_TOKEN_TTL.
+var PasswordChangeTokenTTL = helper.GetEnvDuration("PASSWORD_CHANGE_TOKEN_TTL", 10*time.Minute)
+
+// checkPasswordHistory refuses password when it is the current or a recent password of user.
+func checkPasswordHistory(user models.User, password string) error {
+	hashes := user.Password_history
+	if user.Password != nil {
+		hashes = append([]string{*user.Password}, hashes...)
+	}
+	for _, hash := range hashes {
+		if valid, _ := VerifyPassword(password, hash); valid {
+			return newError(InvalidArgument, "this password has been used recently; choose another one")
+		}
+	}
+	return nil
+}
+
+// passwordExpired reports whether the password of user is older than PasswordMaxAge.
+func passwordExpired(user models.User) bool {
+	return PasswordMaxAge > 0 && time.Since(user.PasswordChangedAt()) > PasswordMaxAge
+}
+
+// passwordExpiredError returns the error Login answers with for user, whose password has
+// expired. It carries a token for ChangeExpiredPassword.
+func passwordExpiredError(user models.User) error {
+	token, err := helper.GeneratePasswordChangeToken(*user.Email, user.User_id, PasswordChangeTokenTTL)
+	if err != nil {
+		return newError(Internal, "error occurred while creating the password change token")
+	}
+	return &Error{Code: PasswordExpired, Message: "the password has expired and must be changed", Change_token: token}
+}
+
+// ChangeExpiredPassword sets a new password with the token Login returned for an expired
+// one and signs out every session of the user, who then signs in with the new password.
+func ChangeExpiredPassword(ctx context.Context, token string, password string) (err error) {
+	claims, msg := helper.ValidateToken(token)
+	if msg == "" && claims.Token_type != helper.PasswordChangeToken {
+		msg = "the token is not a password change token"
+	}
+	if msg != "" {
+		return newError(Unauthenticated, msg)
+	}
+	if err := checkRateLimit(ctx, rateLimitPasswordChange, helper.RequestInfoFromContext(ctx).Ip, claims.Email); err != nil {
+		return err
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{Action: helper.AuditPasswordChanged, Actor_id: claims.Uid, Target_id: claims.Uid,
+			Details: map[string]string{"reason": "expired"}}, err)
+	}()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&user); err != nil {
+		return newError(Unauthenticated, "the user no longer exists")
+	}
+	// The token is used up once the password has changed after it was issued
+	if user.PasswordChangedAt().Unix() >= claims.IssuedAt {
+		return newError(Unauthenticated, "the password has already been changed")
+	}
+	if msg := helper.CheckUserStatus(user); msg != "" {
+		return newError(PermissionDenied, msg)
+	}
+	if err := checkPassword(password, user); err != nil {
+		return err
+	}
+	if err := checkPasswordHistory(user, password); err != nil {
+		return err
+	}
+	if err := setPassword(ctx, user, password); err != nil {
+		return err
+	}
+	// Access tokens issued before the password expired stay valid until their session ends
+	if _, err := helper.RevokeSessions(user.User_id, bson.M{}); err != nil {
+		return newError(Internal, "error occurred while signing out the user's sessions")
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build integration
+
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+)
+
+func TestChangeExpiredPasswordSignsOutSessions(t *testing.T) {
+	requireDatabase(t)
+	maxAge := PasswordMaxAge
+	PasswordMaxAge = time.Hour
+	t.Cleanup(func() { PasswordMaxAge = maxAge })
+
+	user := newTestUser(t, "Old-password-1", time.Now().Add(-2*time.Hour))
+	if !passwordExpired(user) {
+		t.Fatal("the test user's password should have expired")
+	}
+
+	// An access token issued before the password expired
+	session, err := helper.CreateSession(user.User_id, "test", "127.0.0.1", []string{helper.AmrPassword})
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	accessToken, _, err := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id, session)
+	if err != nil {
+		t.Fatalf("GenerateAllTokens: %v", err)
+	}
+	if _, msg := helper.ResolveToken(accessToken); msg != "" {
+		t.Fatalf("access token rejected before the password change: %s", msg)
+	}
+
+	expired, ok := passwordExpiredError(user).(*Error)
+	if !ok || expired.Code != PasswordExpired {
+		t.Fatalf("passwordExpiredError = %v, want a PasswordExpired error", expired)
+	}
+	if err := ChangeExpiredPassword(context.Background(), expired.Change_token, "New-password-2"); err != nil {
+		t.Fatalf("ChangeExpiredPassword: %v", err)
+	}
+
+	if claims, msg := helper.ResolveToken(accessToken); msg == "" {
+		t.Errorf("access token still accepted after the password change: %+v", claims)
+	}
+}
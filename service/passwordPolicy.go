@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+)
+
+// The default maximum length in bytes. bcrypt ignores anything after 72 bytes; the other
+// hashers take any length, so their limit only stops absurdly long input.
+const (
+	bcryptMaxLength  = 72
+	defaultMaxLength = 256
+)
+
+// PasswordPolicy decides which passwords users may choose.
+type PasswordPolicy struct {
+	Min_length  int // in characters
+	Max_length  int // in bytes, so multi-byte characters count for what bcrypt sees
+	Min_classes int // how many of lower case, upper case, digits and symbols are required
+
+	// Breached_file lists the hex SHA-1 hashes of known breached passwords, one per line,
+	// optionally followed by ":count". It is loaded into memory, so keep it to a common
+	// password list.
+	Breached_file string
+	// Breached_dir holds a file per 5 character SHA-1 prefix, named like the prefix with an
+	// optional .txt extension, each listing "suffix:count" lines as served by the Pwned
+	// Passwords range API. Only the file of the checked prefix is read, so it can hold a
+	// full copy of the list.
+	Breached_dir string
+
+	breached map[string]bool
+}
+
+// passwordPolicy is set with PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_MIN_CLASSES,
+// PASSWORD_BREACHED_FILE and PASSWORD_BREACHED_DIR.
+var passwordPolicy = loadPasswordPolicy()
+
+func loadPasswordPolicy() *PasswordPolicy {
+	maxLength := defaultMaxLength
+	if passwordHashers.Current.Algorithm() == "bcrypt" {
+		maxLength = bcryptMaxLength
+	}
+	policy := &PasswordPolicy{
+		Min_length:    helper.GetEnvInt("PASSWORD_MIN_LENGTH", 8),
+		Max_length:    helper.GetEnvInt("PASSWORD_MAX_LENGTH", maxLength),
+		Min_classes:   helper.GetEnvInt("PASSWORD_MIN_CLASSES", 2),
+		Breached_file: helper.GetEnv("PASSWORD_BREACHED_FILE", ""),
+		Breached_dir:  helper.GetEnv("PASSWORD_BREACHED_DIR", ""),
+	}
+	if policy.Breached_file != "" {
+		if err := policy.loadBreachedFile(); err != nil {
+			log.Fatal("error occurred while loading PASSWORD_BREACHED_FILE: ", err)
+		}
+	}
+	return policy
+}
+
+func (p *PasswordPolicy) loadBreachedFile() error {
+	file, err := os.Open(p.Breached_file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	p.breached = map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hash) == sha1.Size*2 {
+			p.breached[strings.ToUpper(hash)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// Check returns why password may not be used by user, or nil when it may.
+func (p *PasswordPolicy) Check(password string, user models.User) error {
+	if utf8.RuneCountInString(password) < p.Min_length {
+		return fmt.Errorf("the password must be at least %d characters long", p.Min_length)
+	}
+	if p.Max_length > 0 && len(password) > p.Max_length {
+		return fmt.Errorf("the password must be at most %d bytes long", p.Max_length)
+	}
+	if classes := characterClasses(password); classes < p.Min_classes {
+		return fmt.Errorf("the password must mix at least %d of lower case letters, upper case letters, digits and symbols", p.Min_classes)
+	}
+
+	lower := strings.ToLower(password)
+	for _, part := range personalParts(user) {
+		if strings.Contains(lower, part) {
+			return errors.New("the password must not contain your name or email address")
+		}
+	}
+
+	breached, err := p.isBreached(password)
+	if err != nil {
+		// The list is a safeguard; being unable to read it shouldn't stop every signup
+		log.Println("error occurred while checking the breached password list:", err)
+	}
+	if breached {
+		return errors.New("this password has appeared in a data breach; choose another one")
+	}
+	return nil
+}
+
+// characterClasses counts how many of lower case, upper case, digits and other characters
+// password uses.
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, used := range []bool{lower, upper, digit, other} {
+		if used {
+			classes++
+		}
+	}
+	return classes
+}
+
+// personalParts returns the lower cased names and email local part of user that are long
+// enough to be worth refusing in a password.
+func personalParts(user models.User) []string {
+	var parts []string
+	add := func(value *string) {
+		if value != nil && utf8.RuneCountInString(*value) >= 3 {
+			parts = append(parts, strings.ToLower(*value))
+		}
+	}
+	add(user.First_name)
+	add(user.Last_name)
+	if user.Email != nil {
+		local, _, _ := strings.Cut(*user.Email, "@")
+		add(&local)
+	}
+	return parts
+}
+
+// isBreached looks password up in the breached password lists without any network access.
+func (p *PasswordPolicy) isBreached(password string) (bool, error) {
+	if p.breached == nil && p.Breached_dir == "" {
+		return false, nil
+	}
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	if p.breached[hash] {
+		return true, nil
+	}
+	if p.Breached_dir == "" {
+		return false, nil
+	}
+
+	prefix, suffix := hash[:5], hash[5:]
+	file, err := os.Open(filepath.Join(p.Breached_dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(p.Breached_dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// checkPassword applies the password policy, as an InvalidArgument error.
+func checkPassword(password string, user models.User) error {
+	if err := passwordPolicy.Check(password, user); err != nil {
+		return newError(InvalidArgument, err.Error())
+	}
+	return nil
+}
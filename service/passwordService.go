@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/url"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var passwordResetCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "password_reset")
+
+// PasswordResetTTL is how long an emailed reset link works, set with PASSWORD_RESET_TTL.
+var PasswordResetTTL = helper.GetEnvDuration("PASSWORD_RESET_TTL", time.Hour)
+
+// PasswordResetURL, set with PASSWORD_RESET_URL, is the page that lets the user choose a
+// new password. The reset token is added to it as the token query parameter.
+var PasswordResetURL = helper.GetEnv("PASSWORD_RESET_URL", "http://localhost:8080/reset-password")
+
+// ChangePassword replaces the password of the caller after checking their current one.
+// Only interactive sessions may change a password, and every other session of the caller
+// is signed out.
+func ChangePassword(ctx context.Context, caller helper.Identity, currentPassword string, newPassword string) (err error) {
+	userId := caller.GetString("uid")
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckNotImpersonating(caller); err != nil {
+		return newError(PermissionDenied, err.Error())
+	}
+	// Stop a stolen access token from being used to guess the password
+	if err := checkRateLimit(ctx, rateLimitPasswordChange, helper.RequestInfoFromContext(ctx).Ip, caller.GetString("email")); err != nil {
+		return err
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{Action: helper.AuditPasswordChanged, Actor_id: userId, Target_id: userId}, err)
+	}()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil || user.Password == nil {
+		return newError(NotFound, "user not found")
+	}
+	if valid, _ := VerifyPassword(currentPassword, *user.Password); !valid {
+		return newError(Unauthenticated, "the current password is incorrect")
+	}
+	if err := checkPassword(newPassword, user); err != nil {
+		return err
+	}
+	if err := checkPasswordHistory(user, newPassword); err != nil {
+		return err
+	}
+
+	if err := setPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+	// Keep the session the password was changed from signed in
+	if _, err := helper.RevokeSessions(userId, bson.M{"session_id": bson.M{"$ne": caller.GetString("session_id")}}); err != nil {
+		return newError(Internal, "error occurred while signing out the other sessions")
+	}
+	return nil
+}
+
+// RequestPasswordReset emails a password reset link to email. Whether or not the address
+// belongs to a user that may reset their password, it succeeds the same way, so it can't
+// be used to find out who has an account.
+func RequestPasswordReset(ctx context.Context, email string) error {
+	ip := helper.RequestInfoFromContext(ctx).Ip
+	if err := checkRateLimit(ctx, rateLimitPasswordReset, ip, email); err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		return nil
+	}
+	if msg := helper.CheckUserStatus(user); msg != "" {
+		return nil
+	}
+
+	token, err := generateResetToken()
+	if err != nil {
+		return newError(Internal, "error occurred while creating the reset link")
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	reset := models.PasswordReset{
+		ID:         primitive.NewObjectID(),
+		Token_hash: helper.HashToken(token),
+		User_id:    user.User_id,
+		Ip:         ip,
+		Created_at: now,
+		Expires_at: now.Add(PasswordResetTTL),
+	}
+	if _, err := passwordResetCollection.InsertOne(ctx, reset); err != nil {
+		return newError(Internal, "error occurred while creating the reset link")
+	}
+
+	helper.SendMailAsync(email, "Reset your password",
+		"Someone asked to reset the password of your account. To choose a new password, open\n\n"+
+			PasswordResetURL+"?token="+url.QueryEscape(token)+"\n\n"+
+			"The link works once and expires in "+PasswordResetTTL.String()+". "+
+			"If you didn't ask for it, you can ignore this email.\n")
+	helper.RecordAuditEvent(ctx, models.AuditEvent{Action: helper.AuditPasswordResetRequested, Actor_id: user.User_id, Target_id: user.User_id})
+	return nil
+}
+
+// ResetPasswordWithToken sets a new password for the user a reset token was emailed to.
+// The token works once; all of the user's sessions are signed out, any lockout after failed
+// logins is lifted and their other reset links stop working.
+func ResetPasswordWithToken(ctx context.Context, token string, password string) (err error) {
+	if err := checkRateLimit(ctx, rateLimitPasswordReset, helper.RequestInfoFromContext(ctx).Ip, ""); err != nil {
+		return err
+	}
+
+	invalid := newError(InvalidArgument, "the reset link is invalid or has expired")
+	var reset models.PasswordReset
+	tokenFilter := bson.M{"token_hash": helper.HashToken(token), "used_at": nil, "expires_at": bson.M{"$gt": time.Now()}}
+	if err := passwordResetCollection.FindOne(ctx, tokenFilter).Decode(&reset); err != nil {
+		return invalid
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{Action: helper.AuditPasswordReset, Actor_id: reset.User_id, Target_id: reset.User_id}, err)
+	}()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": reset.User_id}).Decode(&user); err != nil {
+		return invalid
+	}
+	if msg := helper.CheckUserStatus(user); msg != "" {
+		return newError(PermissionDenied, msg)
+	}
+	// Check the password before using up the token, so a rejected one can be corrected
+	if err := checkPassword(password, user); err != nil {
+		return err
+	}
+	if err := checkPasswordHistory(user, password); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	result, err := passwordResetCollection.UpdateOne(ctx, tokenFilter, bson.M{"$set": bson.M{"used_at": now}})
+	if err != nil {
+		return newError(Internal, "error occurred while resetting the password")
+	}
+	if result.ModifiedCount == 0 {
+		return invalid
+	}
+
+	if err := setPassword(ctx, user, password); err != nil {
+		return err
+	}
+	passwordResetCollection.UpdateMany(ctx, bson.M{"user_id": user.User_id, "used_at": nil}, bson.M{"$set": bson.M{"used_at": now}})
+	clearFailedLogins(ctx, user)
+	if _, err := helper.RevokeSessions(user.User_id, bson.M{}); err != nil {
+		return newError(Internal, "error occurred while signing out the user's sessions")
+	}
+	return nil
+}
+
+// setPassword hashes and stores a new password for user, moving the current one into the
+// password history.
+func setPassword(ctx context.Context, user models.User, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return newError(Internal, "error occurred while hashing the password")
+	}
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	update := bson.M{"$set": bson.M{
+		"password":            hash,
+		"password_changed_at": now,
+		"updated_at":          now,
+	}}
+	if PasswordHistorySize > 0 && user.Password != nil {
+		update["$push"] = bson.M{"password_history": bson.M{"$each": []string{*user.Password}, "$slice": -PasswordHistorySize}}
+	}
+	result, err := userCollection.UpdateOne(ctx, bson.M{"user_id": user.User_id}, update)
+	if err != nil {
+		return newError(Internal, "error occurred while changing the password")
+	}
+	if result.MatchedCount == 0 {
+		return newError(NotFound, "user not found")
+	}
+	return nil
+}
+
+// generateResetToken returns a random, URL safe password reset token.
+func generateResetToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
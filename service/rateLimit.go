@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/ratelimit"
+)
+
+// Rate limited operations. Logins from a known device take from the per-email bucket of
+// rateLimitLoginDevice instead of rateLimitLogin, so failing logins on purpose elsewhere
+// can't keep the user from signing in on their own devices.
+const (
+	rateLimitLogin          = "login"
+	rateLimitSignup         = "signup"
+	rateLimitPasswordReset  = "password_reset"
+	rateLimitPasswordChange = "password_change"
+	rateLimitLoginVerify    = "login_verify"
+	rateLimitTOTP           = "totp"
+	rateLimitReauthenticate = "reauthenticate"
+	rateLimitEmailChange    = "email_change"
+	rateLimitLoginDevice    = "login_device"
+)
+
+// rateLimitPolicy holds the limits applied to one operation: per client IP address, per
+// email address it targets, and across all clients together.
+type rateLimitPolicy struct {
+	ip     ratelimit.Limit
+	email  ratelimit.Limit
+	global ratelimit.Limit
+}
+
+// rateLimits are configured with RATE_LIMIT_<OPERATION>_IP, _EMAIL and _GLOBAL, each written
+// as "<burst>/<duration>" or "off". Hashing a password is expensive, so the global limits
+// also keep a flood of logins from using up the CPU.
+var rateLimits = map[string]rateLimitPolicy{
+	rateLimitLogin:          loadRateLimitPolicy(rateLimitLogin, "20/1m", "5/1m", "50/1s"),
+	rateLimitSignup:         loadRateLimitPolicy(rateLimitSignup, "10/1h", "3/1h", "20/1s"),
+	rateLimitPasswordReset:  loadRateLimitPolicy(rateLimitPasswordReset, "10/1h", "3/1h", "20/1s"),
+	rateLimitPasswordChange: loadRateLimitPolicy(rateLimitPasswordChange, "10/15m", "5/15m", "50/1s"),
+	rateLimitLoginVerify:    loadRateLimitPolicy(rateLimitLoginVerify, "20/15m", "10/15m", "50/1s"),
+	rateLimitTOTP:           loadRateLimitPolicy(rateLimitTOTP, "10/15m", "5/15m", "50/1s"),
+	rateLimitReauthenticate: loadRateLimitPolicy(rateLimitReauthenticate, "10/15m", "5/15m", "50/1s"),
+	rateLimitEmailChange:    loadRateLimitPolicy(rateLimitEmailChange, "10/1h", "3/1h", "20/1s"),
+	rateLimitLoginDevice:    loadRateLimitPolicy(rateLimitLoginDevice, "off", "10/1m", "off"),
+}
+
+// limiter keeps its buckets in memory, or in Redis at REDIS_URL when RATE_LIMIT_STORE is
+// "redis" so that every instance enforces the same limits. While Redis is unreachable each
+// instance enforces the limits on its own, rather than letting logins be guessed freely.
+var limiter = newLimiter()
+
+func newLimiter() *ratelimit.Limiter {
+	prefix := "ratelimit:"
+	switch store := helper.GetEnv("RATE_LIMIT_STORE", "memory"); store {
+	case "memory":
+		return &ratelimit.Limiter{Store: ratelimit.NewMemoryStore(), Prefix: prefix}
+	case "redis":
+		redisStore, err := ratelimit.NewRedisStore(helper.GetEnv("REDIS_URL", "redis://localhost:6379/0"))
+		if err != nil {
+			log.Fatal("invalid REDIS_URL: ", err)
+		}
+		return &ratelimit.Limiter{Store: redisStore, Fallback: ratelimit.NewMemoryStore(), Prefix: prefix}
+	default:
+		log.Fatal("unknown RATE_LIMIT_STORE ", store)
+		return nil
+	}
+}
+
+func loadRateLimitPolicy(operation string, ip string, email string, global string) rateLimitPolicy {
+	prefix := "RATE_LIMIT_" + strings.ToUpper(operation) + "_"
+	return rateLimitPolicy{
+		ip:     loadRateLimit(prefix+"IP", ip),
+		email:  loadRateLimit(prefix+"EMAIL", email),
+		global: loadRateLimit(prefix+"GLOBAL", global),
+	}
+}
+
+func loadRateLimit(key string, fallback string) ratelimit.Limit {
+	limit, err := ratelimit.ParseLimit(helper.GetEnv(key, fallback))
+	if err != nil {
+		log.Fatal(key, ": ", err)
+	}
+	return limit
+}
+
+// checkRateLimit takes a token for operation from the buckets of the client at ip, of email
+// and of everybody, stopping at the first one that is empty. Either key may be empty when
+// it isn't known.
+func checkRateLimit(ctx context.Context, operation string, ip string, email string) error {
+	policy := rateLimits[operation]
+	return takeRateLimits(ctx, operation, []rateLimitCheck{
+		{ip != "", "ip:" + ip, policy.ip},
+		{email != "", emailRateLimitKey(email), policy.email},
+		{true, "global", policy.global},
+	})
+}
+
+// checkEmailRateLimit only takes a token for operation from the bucket of email, for when
+// the other buckets were already checked or the bucket depends on who is asking.
+func checkEmailRateLimit(ctx context.Context, operation string, email string) error {
+	return takeRateLimits(ctx, operation, []rateLimitCheck{
+		{email != "", emailRateLimitKey(email), rateLimits[operation].email},
+	})
+}
+
+type rateLimitCheck struct {
+	known bool
+	key   string
+	limit ratelimit.Limit
+}
+
+func takeRateLimits(ctx context.Context, operation string, checks []rateLimitCheck) error {
+	for _, check := range checks {
+		if !check.known {
+			continue
+		}
+		if wait, ok := limiter.Allow(ctx, operation+":"+check.key, check.limit); !ok {
+			return &Error{Code: ResourceExhausted, Message: "too many requests, try again later", Retry_after: wait}
+		}
+	}
+	return nil
+}
+
+// emailRateLimitKey hashes email so the store doesn't hold who is signing in.
+func emailRateLimitKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "email:" + hex.EncodeToString(sum[:16])
+}
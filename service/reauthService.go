@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+)
+
+// ReauthPassword reauthenticates with the account password; StepUpTOTP works as well, with
+// a code from the authenticator app.
+const ReauthPassword = "password"
+
+// Reauthenticate checks the caller's password or authenticator code again and marks their
+// session as freshly authenticated, so routes guarded by a recent authentication accept it.
+// It returns a new token pair for the session carrying the new auth_time and amr claims;
+// the previous refresh token stops working.
+func Reauthenticate(ctx context.Context, caller helper.Identity, method string, secret string) (token string, refreshToken string, err error) {
+	userId := caller.GetString("uid")
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return "", "", newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckNotImpersonating(caller); err != nil {
+		return "", "", newError(PermissionDenied, err.Error())
+	}
+	// A stolen access token mustn't become a way to guess the password or code
+	if err := checkRateLimit(ctx, rateLimitReauthenticate, helper.RequestInfoFromContext(ctx).Ip, caller.GetString("email")); err != nil {
+		return "", "", err
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{
+			Action:    helper.AuditReauthenticated,
+			Actor_id:  userId,
+			Target_id: userId,
+			Details:   map[string]string{"method": method, "session_id": caller.GetString("session_id")},
+		}, err)
+	}()
+
+	user, err := loadUser(ctx, userId)
+	if err != nil {
+		return "", "", err
+	}
+	if msg := helper.CheckUserStatus(user); msg != "" {
+		return "", "", newError(PermissionDenied, msg)
+	}
+
+	var amr []string
+	switch method {
+	case ReauthPassword:
+		if user.Password == nil {
+			return "", "", newError(Unauthenticated, "the password is incorrect")
+		}
+		if valid, _ := VerifyPassword(secret, *user.Password); !valid {
+			return "", "", newError(Unauthenticated, "the password is incorrect")
+		}
+		amr = []string{helper.AmrPassword}
+	case StepUpTOTP:
+		if err := checkTOTP(ctx, user, secret); err != nil {
+			return "", "", err
+		}
+		amr = []string{helper.AmrOTP}
+	default:
+		return "", "", newError(InvalidArgument, "method must be password or totp")
+	}
+
+	session, msg := helper.ReauthenticateSession(caller.GetString("session_id"), userId, amr)
+	if msg != "" {
+		return "", "", newError(Unauthenticated, msg)
+	}
+	token, refreshToken, _ = helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id, session)
+	if err := helper.UpdateSessionTokens(session.Session_id, refreshToken); err != nil {
+		return "", "", newError(Internal, "error occurred while updating the session")
+	}
+	return token, refreshToken, nil
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BootstrapAdminToken, set with BOOTSTRAP_ADMIN_TOKEN, lets the first ADMIN sign up over
+// the API instead of with authctl. It works once, and not at all once any ADMIN exists.
+var BootstrapAdminToken = helper.GetEnv("BOOTSTRAP_ADMIN_TOKEN", "")
+
+// bootstrapCollection holds the marker claimed by the ADMIN created with the bootstrap token.
+var bootstrapCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "bootstrap")
+
+// bootstrapAdminMarker is the _id of the marker; only one request can ever insert it.
+const bootstrapAdminMarker = "admin"
+
+// BootstrapAdmin creates the first ADMIN when token matches BOOTSTRAP_ADMIN_TOKEN and no
+// ADMIN exists yet. Requests racing each other each see no ADMIN, so the bootstrap is
+// claimed by inserting a marker with a fixed id first: only one insert succeeds.
+func BootstrapAdmin(ctx context.Context, user models.User, token string) (models.User, error) {
+	// Limited like signup, which also keeps the token from being guessed
+	if err := checkSignupRateLimit(ctx, user); err != nil {
+		return user, err
+	}
+	if BootstrapAdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(BootstrapAdminToken)) != 1 {
+		return user, newError(PermissionDenied, "invalid bootstrap token")
+	}
+
+	adminExists := newError(PermissionDenied, "an ADMIN already exists; ask them to promote you")
+	admins, err := userCollection.CountDocuments(ctx, bson.M{"user_type": "ADMIN"})
+	if err != nil {
+		return user, newError(Internal, "error occurred while checking for existing admins")
+	}
+	if admins > 0 {
+		return user, adminExists
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	_, err = bootstrapCollection.InsertOne(ctx, bson.M{"_id": bootstrapAdminMarker, "created_at": now})
+	if mongo.IsDuplicateKeyError(err) {
+		return user, adminExists
+	}
+	if err != nil {
+		return user, newError(Internal, "error occurred while checking for existing admins")
+	}
+
+	userType := "ADMIN"
+	user.User_type = &userType
+	user, err = createUser(ctx, user)
+	if err != nil {
+		// Nobody was made ADMIN, so let the bootstrap be tried again
+		bootstrapCollection.DeleteOne(ctx, bson.M{"_id": bootstrapAdminMarker})
+		return user, err
+	}
+	bootstrapCollection.UpdateOne(ctx, bson.M{"_id": bootstrapAdminMarker}, bson.M{"$set": bson.M{"user_id": user.User_id}})
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{Action: helper.AuditAdminBootstrap, Actor_id: user.User_id, Target_id: user.User_id})
+	return user, nil
+}
+
+// ChangeRole sets the user type of userId to role. Only ADMINs on an interactive session
+// may change roles, and the last active ADMIN can't be demoted. The user's sessions are signed out
+// so their next tokens carry the new role, and the change is written to the audit log.
+func ChangeRole(ctx context.Context, caller helper.Identity, userId string, role string) (models.User, error) {
+	var user models.User
+
+	if err := helper.CheckUserType(caller, "ADMIN"); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckNotImpersonating(caller); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if role != "ADMIN" && role != "USER" {
+		return user, newError(InvalidArgument, "user_type must be ADMIN or USER")
+	}
+
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, newError(NotFound, "user not found")
+	}
+	if err != nil {
+		return user, newError(Internal, err.Error())
+	}
+	sanitize(&user)
+
+	previous := *user.User_type
+	if previous == role {
+		return user, nil
+	}
+
+	lastAdmin := newError(PermissionDenied, "the last active ADMIN can't be demoted")
+	if previous == "ADMIN" {
+		others, err := countActiveAdmins(ctx, bson.M{"user_id": bson.M{"$ne": userId}})
+		if err != nil {
+			return user, newError(Internal, "error occurred while counting admins")
+		}
+		if others == 0 {
+			return user, lastAdmin
+		}
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId, "user_type": previous}, bson.M{"$set": bson.M{
+		"user_type":  role,
+		"updated_at": now,
+	}})
+	if err != nil {
+		return user, newError(Internal, "error occurred while changing the role")
+	}
+	if result.ModifiedCount == 0 {
+		return user, newError(InvalidArgument, "the user's role changed meanwhile; try again")
+	}
+
+	// Demotions running at the same time each saw the others' ADMINs; count again now that
+	// this one is made and take it back if no active ADMIN is left
+	if previous == "ADMIN" {
+		admins, err := countActiveAdmins(ctx, bson.M{})
+		if err != nil || admins == 0 {
+			userCollection.UpdateOne(ctx, bson.M{"user_id": userId, "user_type": role}, bson.M{"$set": bson.M{"user_type": previous}})
+			if err != nil {
+				return user, newError(Internal, "error occurred while counting admins")
+			}
+			return user, lastAdmin
+		}
+	}
+	user.User_type = &role
+	user.Updated_at = now
+
+	// Tokens carry the user type, so sign the user out everywhere to pick up the new one
+	helper.RevokeSessions(userId, bson.M{})
+
+	helper.RecordAuditEvent(ctx, models.AuditEvent{
+		Action:    helper.AuditRoleChanged,
+		Actor_id:  caller.GetString("uid"),
+		Target_id: userId,
+		Details:   map[string]string{"from": previous, "to": role},
+	})
+	return user, nil
+}
+
+// countActiveAdmins counts the ADMINs matching filter that can sign in: not suspended,
+// pending, deleted or locked.
+func countActiveAdmins(ctx context.Context, filter bson.M) (int64, error) {
+	filter["user_type"] = "ADMIN"
+	filter["status"] = bson.M{"$in": []interface{}{models.UserActive, nil}}
+	filter["locked_at"] = nil
+	return userCollection.CountDocuments(ctx, filter)
+}
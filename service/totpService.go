@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TOTPEnrollment is the secret of a new authenticator app, to be typed in or scanned from
+// a QR code of URI.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// EnrollTOTP starts adding an authenticator app to the caller's account. The secret only
+// takes effect once ConfirmTOTP is called with a code from the app; calling EnrollTOTP
+// again before that replaces it.
+func EnrollTOTP(ctx context.Context, caller helper.Identity) (TOTPEnrollment, error) {
+	var enrollment TOTPEnrollment
+	if err := checkTOTPCaller(caller); err != nil {
+		return enrollment, err
+	}
+
+	user, err := loadUser(ctx, caller.GetString("uid"))
+	if err != nil {
+		return enrollment, err
+	}
+	if user.Totp_secret != "" {
+		return enrollment, newError(AlreadyExists, "an authenticator app is already set up; remove it first")
+	}
+
+	secret, err := helper.GenerateTOTPSecret()
+	if err != nil {
+		return enrollment, newError(Internal, "error occurred while creating the secret")
+	}
+	sealed, err := helper.SealSecret(secret)
+	if err != nil {
+		return enrollment, newError(Internal, "error occurred while creating the secret")
+	}
+	if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": user.User_id}, bson.M{"$set": bson.M{"totp_pending_secret": sealed}}); err != nil {
+		return enrollment, newError(Internal, "error occurred while storing the secret")
+	}
+	return TOTPEnrollment{Secret: secret, URI: helper.TOTPURI(*user.Email, secret)}, nil
+}
+
+// ConfirmTOTP turns on the authenticator app from EnrollTOTP once code shows it was set up.
+func ConfirmTOTP(ctx context.Context, caller helper.Identity, code string) (err error) {
+	userId := caller.GetString("uid")
+	if err := checkTOTPCaller(caller); err != nil {
+		return err
+	}
+	if err := checkRateLimit(ctx, rateLimitTOTP, helper.RequestInfoFromContext(ctx).Ip, caller.GetString("email")); err != nil {
+		return err
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{Action: helper.AuditTOTPEnabled, Actor_id: userId, Target_id: userId}, err)
+	}()
+
+	user, err := loadUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user.Totp_pending_secret == "" {
+		return newError(NotFound, "no authenticator app is being set up")
+	}
+	secret, err := helper.OpenSecret(user.Totp_pending_secret)
+	if err != nil {
+		return newError(Internal, "error occurred while reading the secret")
+	}
+	step, ok := helper.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return newError(InvalidArgument, "the code is incorrect")
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"user_id": userId, "totp_pending_secret": user.Totp_pending_secret},
+		bson.M{
+			"$set":   bson.M{"totp_secret": user.Totp_pending_secret, "totp_last_step": step, "totp_enabled_at": now},
+			"$unset": bson.M{"totp_pending_secret": ""},
+		},
+	)
+	if err != nil {
+		return newError(Internal, "error occurred while turning on the authenticator app")
+	}
+	if result.ModifiedCount == 0 {
+		return newError(NotFound, "no authenticator app is being set up")
+	}
+	return nil
+}
+
+// DisableTOTP removes the caller's authenticator app, which takes a current code from it.
+func DisableTOTP(ctx context.Context, caller helper.Identity, code string) (err error) {
+	userId := caller.GetString("uid")
+	if err := checkTOTPCaller(caller); err != nil {
+		return err
+	}
+	if err := checkRateLimit(ctx, rateLimitTOTP, helper.RequestInfoFromContext(ctx).Ip, caller.GetString("email")); err != nil {
+		return err
+	}
+
+	defer func() {
+		audit(ctx, models.AuditEvent{Action: helper.AuditTOTPDisabled, Actor_id: userId, Target_id: userId}, err)
+	}()
+
+	user, err := loadUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if user.Totp_secret == "" {
+		return newError(NotFound, "no authenticator app is set up")
+	}
+	if err := checkTOTP(ctx, user, code); err != nil {
+		return err
+	}
+
+	_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.M{
+		"$unset": bson.M{"totp_secret": "", "totp_pending_secret": "", "totp_last_step": "", "totp_enabled_at": ""},
+	})
+	if err != nil {
+		return newError(Internal, "error occurred while removing the authenticator app")
+	}
+	return nil
+}
+
+// checkTOTP verifies a code from the authenticator app of user. Each code works once: the
+// time step of an accepted code is stored and codes from it or earlier steps are refused.
+func checkTOTP(ctx context.Context, user models.User, code string) error {
+	if user.Totp_secret == "" {
+		return newError(InvalidArgument, "no authenticator app is set up")
+	}
+	secret, err := helper.OpenSecret(user.Totp_secret)
+	if err != nil {
+		return newError(Internal, "error occurred while reading the secret")
+	}
+	step, ok := helper.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return newError(Unauthenticated, "the code is incorrect")
+	}
+
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"user_id": user.User_id, "$or": []bson.M{
+			{"totp_last_step": bson.M{"$lt": step}},
+			{"totp_last_step": bson.M{"$exists": false}},
+		}},
+		bson.M{"$set": bson.M{"totp_last_step": step}},
+	)
+	if err != nil {
+		return newError(Internal, "error occurred while checking the code")
+	}
+	if result.ModifiedCount == 0 {
+		return newError(Unauthenticated, "the code has already been used; wait for the next one")
+	}
+	return nil
+}
+
+// checkTOTPCaller only lets users change their authenticator app from a session they
+// signed in to themselves.
+func checkTOTPCaller(caller helper.Identity) error {
+	if err := helper.CheckInteractiveSession(caller); err != nil {
+		return newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckNotImpersonating(caller); err != nil {
+		return newError(PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+// loadUser returns the user with userId.
+func loadUser(ctx context.Context, userId string) (models.User, error) {
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+		return user, newError(NotFound, "user not found")
+	}
+	return user, nil
+}
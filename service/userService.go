@@ -0,0 +1,418 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/Danitilahun/GO_JWT_Authentication.git/database"
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+	"github.com/Danitilahun/GO_JWT_Authentication.git/model"
+	"github.com/go-playground/validator"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var userCollection *mongo.Collection = database.OpenCollection(database.Client, "auth", "user")
+var validate = validator.New()
+
+// SignupRequiresApproval, set with SIGNUP_REQUIRES_APPROVAL, creates self-service accounts
+// as pending so they can't sign in until an ADMIN reactivates them.
+var SignupRequiresApproval = helper.GetEnvBool("SIGNUP_REQUIRES_APPROVAL", false)
+
+// UserPage is one page of the user listing.
+type UserPage struct {
+	Total_count int64         `json:"total_count"`
+	User_items  []models.User `json:"user_items"`
+}
+
+// HashPassword hashes password with the current password hasher.
+func HashPassword(password string) (string, error) {
+	passwordHashSlots <- struct{}{}
+	defer func() { <-passwordHashSlots }()
+	return passwordHashers.Hash(password)
+}
+
+// VerifyPassword reports whether password matches the stored hash and, if so, whether the
+// hash should be replaced because it was made with an outdated algorithm or parameters.
+func VerifyPassword(password string, hash string) (valid bool, rehash bool) {
+	passwordHashSlots <- struct{}{}
+	defer func() { <-passwordHashSlots }()
+	valid, rehash, err := passwordHashers.Verify(password, hash)
+	if err != nil {
+		log.Println("error occurred while verifying a password:", err)
+	}
+	return valid, rehash
+}
+
+// sanitize removes the password hash before a user leaves the service.
+func sanitize(user *models.User) {
+	user.Password = nil
+	user.Password_history = nil
+}
+
+// Signup validates and stores a new user. Self-service accounts are always USERs; an
+// empty user type defaults to USER and asking for ADMIN is refused.
+func Signup(ctx context.Context, user models.User) (created models.User, err error) {
+	// Rejected requests aren't audited, so a flood of them can't flood the audit log too
+	if err := checkSignupRateLimit(ctx, user); err != nil {
+		return user, err
+	}
+
+	defer func() {
+		email := ""
+		if user.Email != nil {
+			email = *user.Email
+		}
+		audit(ctx, models.AuditEvent{
+			Action:    helper.AuditSignup,
+			Actor_id:  created.User_id,
+			Target_id: created.User_id,
+			Details:   map[string]string{"email": email},
+		}, err)
+	}()
+
+	if user.User_type != nil && *user.User_type == "ADMIN" {
+		return user, newError(PermissionDenied, "ADMIN accounts can't be created through signup")
+	}
+	if user.User_type == nil || *user.User_type == "" {
+		userType := "USER"
+		user.User_type = &userType
+	}
+
+	// New accounts wait for an ADMIN to reactivate them when approval is required
+	user.Status = models.UserActive
+	if SignupRequiresApproval {
+		user.Status = models.UserPending
+	}
+	return createUser(ctx, user)
+}
+
+// checkSignupRateLimit applies the signup rate limits to a request to create user.
+func checkSignupRateLimit(ctx context.Context, user models.User) error {
+	email := ""
+	if user.Email != nil {
+		email = *user.Email
+	}
+	return checkRateLimit(ctx, rateLimitSignup, helper.RequestInfoFromContext(ctx).Ip, email)
+}
+
+// createUser validates and stores a new user of any type.
+func createUser(ctx context.Context, user models.User) (models.User, error) {
+	// Validate the user struct using the validator
+	if validationErr := validate.Struct(user); validationErr != nil {
+		return user, newError(InvalidArgument, validationErr.Error())
+	}
+
+	if err := checkPassword(*user.Password, user); err != nil {
+		return user, err
+	}
+
+	// Check if the email or phone number already exists in the database
+	count, err := userCollection.CountDocuments(ctx, bson.M{"$or": []bson.M{
+		{"email": user.Email},
+		{"phone": user.Phone},
+	}})
+	if err != nil {
+		return user, newError(Internal, "error occurred while checking for the email or phone number")
+	}
+	if count > 0 {
+		return user, newError(AlreadyExists, "this email or phone number already exists")
+	}
+
+	// Hash the user's password before saving it
+	password, err := HashPassword(*user.Password)
+	if err != nil {
+		return user, newError(Internal, "error occurred while hashing the password")
+	}
+	user.Password = &password
+
+	// Set timestamps and generate unique identifiers for the user
+	user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	user.Password_changed_at = &user.Created_at
+	user.ID = primitive.NewObjectID()
+	user.User_id = user.ID.Hex()
+	if user.Status == "" {
+		user.Status = models.UserActive
+	}
+
+	// Insert the user details into the database
+	if _, insertErr := userCollection.InsertOne(ctx, user); insertErr != nil {
+		return user, newError(Internal, "User item was not created")
+	}
+
+	sanitize(&user)
+	return user, nil
+}
+
+// Login checks the user's credentials and starts a new session for the device described
+// by userAgent and ip. deviceToken is the device token the client presented, if any; failed
+// logins without the token of one of the user's known devices count towards a lockout. The returned user has
+// Token and Refresh_token filled in, and newDeviceToken is the device token the client
+// should keep. A login from a new device or an implausible place may instead fail with a
+// StepUpRequired error, whose challenge is completed with VerifyLogin.
+func Login(ctx context.Context, email string, password string, userAgent string, ip string, deviceToken string) (foundUser models.User, newDeviceToken string, err error) {
+	ctx = helper.WithRequestInfo(ctx, ip, userAgent)
+
+	// Turn away guessing before the expensive password check; these attempts aren't audited
+	if err := checkRateLimit(ctx, rateLimitLogin, ip, ""); err != nil {
+		return foundUser, "", err
+	}
+
+	// Find the user in the database using their email
+	lookupErr := userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&foundUser)
+
+	// Devices the user signed in from before are exempt from lockouts and have their own
+	// per-email limit, so nobody can lock a user out of them by failing logins on purpose
+	knownDevice := false
+	if lookupErr == nil {
+		if _, knownDevice, err = knownDeviceId(ctx, foundUser.User_id, deviceToken); err != nil {
+			return foundUser, "", newError(Internal, "error occurred while checking the device")
+		}
+	}
+	emailLimit := rateLimitLogin
+	if knownDevice {
+		emailLimit = rateLimitLoginDevice
+	}
+	if err := checkEmailRateLimit(ctx, emailLimit, email); err != nil {
+		return foundUser, "", err
+	}
+
+	// Record every attempt that is checked, successful or not
+	defer func() {
+		audit(ctx, models.AuditEvent{
+			Action:    helper.AuditLogin,
+			Actor_id:  foundUser.User_id,
+			Target_id: foundUser.User_id,
+			Details:   map[string]string{"email": email},
+		}, err)
+	}()
+
+	if lookupErr != nil || foundUser.Password == nil {
+		// Spend as long as a wrong password would, so the answer doesn't tell which emails exist
+		VerifyPassword(password, dummyPasswordHash)
+		return foundUser, "", newError(Unauthenticated, "email or password is incorrect")
+	}
+
+	if !knownDevice {
+		if err := checkLockout(foundUser, time.Now()); err != nil {
+			return foundUser, "", err
+		}
+	}
+
+	// Verify the password provided with the stored hashed password
+	passwordIsValid, rehash := VerifyPassword(password, *foundUser.Password)
+	if !passwordIsValid {
+		if !knownDevice {
+			recordFailedLogin(ctx, foundUser)
+		}
+		return foundUser, "", newError(Unauthenticated, "email or password is incorrect")
+	}
+	clearFailedLogins(ctx, foundUser)
+	// Only now is the plain password at hand to move the hash to the current hasher
+	if rehash {
+		rehashPassword(ctx, foundUser, password)
+	}
+
+	// Locked, suspended, pending and deleted accounts can't sign in
+	if msg := helper.CheckUserStatus(foundUser); msg != "" {
+		return foundUser, "", newError(PermissionDenied, msg)
+	}
+
+	// An expired password gets a token to change it instead of a session
+	if passwordExpired(foundUser) {
+		return foundUser, "", passwordExpiredError(foundUser)
+	}
+
+	// Logins from a new device or an implausible place may have to be confirmed first
+	device, err := identifyDevice(ctx, foundUser, deviceToken, userAgent, ip)
+	if err != nil {
+		return foundUser, "", newError(Internal, "error occurred while checking the device")
+	}
+	if reason := stepUpReason(device); reason != "" {
+		return foundUser, "", startLoginChallenge(ctx, foundUser, device, reason)
+	}
+
+	return completeLogin(ctx, foundUser, device, []string{helper.AmrPassword})
+}
+
+// completeLogin remembers device and starts a new session on it for user, who has proved
+// who they are with the methods in amr. It returns the user with their tokens and the
+// device token of the device.
+func completeLogin(ctx context.Context, user models.User, device loginDevice, amr []string) (models.User, string, error) {
+	rememberDevice(ctx, user, device)
+
+	// Start a new session for this device so other devices stay signed in
+	session, err := helper.CreateSession(user.User_id, device.record.User_agent, device.record.Ip, amr)
+	if err != nil {
+		return user, "", newError(Internal, "error occurred while creating the session")
+	}
+
+	// Generate JWT tokens for the authenticated user and remember the refresh token on the session
+	token, refreshToken, _ := helper.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, *user.User_type, user.User_id, session)
+	if err := helper.UpdateSessionTokens(session.Session_id, refreshToken); err != nil {
+		return user, "", newError(Internal, "error occurred while creating the session")
+	}
+
+	sanitize(&user)
+	user.Token = &token
+	user.Refresh_token = &refreshToken
+	return user, helper.DeviceToken(user.User_id, device.record.Device_id), nil
+}
+
+// rehashPassword replaces the stored hash of user with one from the current hasher. The
+// update only applies if the hash hasn't changed meanwhile, and a failure just leaves the
+// old hash in place until the next login.
+func rehashPassword(ctx context.Context, user models.User, password string) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		log.Println("error occurred while rehashing a password:", err)
+		return
+	}
+	_, err = userCollection.UpdateOne(ctx,
+		bson.M{"user_id": user.User_id, "password": *user.Password},
+		bson.M{"$set": bson.M{"password": hash}},
+	)
+	if err != nil {
+		log.Println("error occurred while rehashing a password:", err)
+	}
+}
+
+// Refresh exchanges a refresh token for a new token pair on the same session.
+// Both tokens are rotated so the old refresh token can't be used again. Once the password
+// has expired, Refresh fails like Login does, with a token for ChangeExpiredPassword.
+func Refresh(ctx context.Context, signedRefreshToken string) (token string, refreshToken string, err error) {
+	// Check the signature and expiry of the refresh token
+	claims, msg := helper.ValidateToken(signedRefreshToken)
+
+	// Record refreshes of genuine tokens; forged or expired ones are just rejected
+	if claims != nil {
+		defer func() {
+			audit(ctx, models.AuditEvent{
+				Action:    helper.AuditTokenRefreshed,
+				Actor_id:  claims.Uid,
+				Target_id: claims.Uid,
+				Details:   map[string]string{"session_id": claims.Session_id},
+			}, err)
+		}()
+	}
+	if msg == "" && claims.Token_type != helper.RefreshToken {
+		msg = "the token is not a refresh token"
+	}
+	if msg != "" {
+		return "", "", newError(Unauthenticated, msg)
+	}
+
+	// The session must still be active
+	session, msg := helper.ValidateSession(claims.Session_id, claims.Uid)
+	if msg != "" {
+		return "", "", newError(Unauthenticated, msg)
+	}
+
+	// A valid but superseded refresh token means it was copied and replayed,
+	// so sign the whole session out rather than pick a winner
+	if !helper.CheckSessionRefreshToken(session, signedRefreshToken) {
+		helper.RevokeSessions(claims.Uid, bson.M{"session_id": session.Session_id})
+		return "", "", newError(Unauthenticated, "the refresh token has already been used")
+	}
+
+	var foundUser models.User
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": claims.Uid}).Decode(&foundUser); err != nil {
+		return "", "", newError(Unauthenticated, "the user no longer exists")
+	}
+	if msg := helper.CheckUserStatus(foundUser); msg != "" {
+		return "", "", newError(Unauthenticated, msg)
+	}
+	// A session doesn't outlive the password it was started with, so an expired password
+	// gets a token to change it here just as it does at login
+	if passwordExpired(foundUser) {
+		return "", "", passwordExpiredError(foundUser)
+	}
+
+	token, refreshToken, _ = helper.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, *foundUser.User_type, foundUser.User_id, session)
+	if err := helper.UpdateSessionTokens(session.Session_id, refreshToken); err != nil {
+		return "", "", newError(Internal, "error occurred while refreshing the session")
+	}
+	return token, refreshToken, nil
+}
+
+// GetUser returns a user. ADMINs can read anyone, USERs only themselves.
+func GetUser(ctx context.Context, caller helper.Identity, userId string) (models.User, error) {
+	var user models.User
+
+	if err := helper.MatchUserTypeToUid(caller, userId); err != nil {
+		return user, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckScope(caller, "users:read"); err != nil {
+		return user, &Error{Code: InsufficientScope, Message: err.Error(), Scope: "users:read"}
+	}
+
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, newError(NotFound, "user not found")
+	}
+	if err != nil {
+		return user, newError(Internal, err.Error())
+	}
+
+	sanitize(&user)
+	return user, nil
+}
+
+// ListUsers returns one page of users, oldest first. Only ADMINs may list users.
+// A page of 0 means the first page and a recordPerPage below 1 means 10; recordPerPage
+// is capped at 100 and a negative page is rejected.
+func ListUsers(ctx context.Context, caller helper.Identity, page int, recordPerPage int) (UserPage, error) {
+	var result UserPage
+
+	if err := helper.CheckUserType(caller, "ADMIN"); err != nil {
+		return result, newError(PermissionDenied, err.Error())
+	}
+	if err := helper.CheckScope(caller, "users:read"); err != nil {
+		return result, &Error{Code: InsufficientScope, Message: err.Error(), Scope: "users:read"}
+	}
+
+	if recordPerPage < 1 {
+		recordPerPage = 10
+	}
+	if recordPerPage > 100 {
+		recordPerPage = 100
+	}
+	if page == 0 {
+		page = 1
+	}
+	if page < 1 {
+		return result, newError(InvalidArgument, "page must be at least 1")
+	}
+	if int64(page-1) > math.MaxInt64/int64(recordPerPage) {
+		return result, newError(InvalidArgument, "page is out of range")
+	}
+
+	total, err := userCollection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return result, newError(Internal, "error occurred while listing user items")
+	}
+
+	opts := options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetSkip(int64(page-1) * int64(recordPerPage)).
+		SetLimit(int64(recordPerPage))
+	cursor, err := userCollection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return result, newError(Internal, "error occurred while listing user items")
+	}
+
+	result.Total_count = total
+	result.User_items = []models.User{}
+	if err = cursor.All(ctx, &result.User_items); err != nil {
+		return result, newError(Internal, "error occurred while listing user items")
+	}
+	for i := range result.User_items {
+		sanitize(&result.User_items[i])
+	}
+	return result, nil
+}
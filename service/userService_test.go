@@ -0,0 +1,44 @@
+//go:build integration
+
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	helper "github.com/Danitilahun/GO_JWT_Authentication.git/helper"
+)
+
+func TestListUsersRejectsBadPages(t *testing.T) {
+	admin := helper.ClaimsIdentity{Claims: &helper.SignedDetails{Uid: "admin", User_type: "ADMIN"}}
+	tests := []struct {
+		name          string
+		page          int
+		recordPerPage int
+	}{
+		{"negative page", -1, 10},
+		{"skip past the largest int64", math.MaxInt64, 100},
+		{"skip past the largest int64 with the default page size", math.MaxInt64/10 + 2, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ListUsers(context.Background(), admin, test.page, test.recordPerPage)
+			if serviceErr, ok := err.(*Error); !ok || serviceErr.Code != InvalidArgument {
+				t.Errorf("ListUsers(page %d, recordPerPage %d) error = %v, want InvalidArgument", test.page, test.recordPerPage, err)
+			}
+		})
+	}
+}
+
+func TestListUsersCapsRecordPerPage(t *testing.T) {
+	requireDatabase(t)
+	admin := helper.ClaimsIdentity{Claims: &helper.SignedDetails{Uid: "admin", User_type: "ADMIN"}}
+	result, err := ListUsers(context.Background(), admin, 1, 1000)
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if len(result.User_items) > 100 {
+		t.Errorf("ListUsers returned %d users, want at most 100", len(result.User_items))
+	}
+}
@@ -0,0 +1,89 @@
+package verifier
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Claims are the identity claims carried by an access token. The JSON names match the
+// tokens issued by the authentication service. AuthTime and AMR say when and how the user
+// last proved who they are; tokens of older sessions don't carry them.
+type Claims struct {
+	Email     string   `json:"Email"`
+	FirstName string   `json:"First_name"`
+	LastName  string   `json:"Last_name"`
+	UserID    string   `json:"Uid"`
+	UserType  string   `json:"User_type"`
+	Scopes    []string `json:"scopes,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	TokenType string   `json:"typ,omitempty"`
+	Act       *Actor   `json:"act,omitempty"`
+	AuthTime  int64    `json:"auth_time,omitempty"`
+	AMR       []string `json:"amr,omitempty"`
+	jwt.StandardClaims
+}
+
+// Actor is the RFC 8693 act claim of an impersonation token: the ADMIN acting as the user.
+type Actor struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+}
+
+// IsImpersonated reports whether an ADMIN is acting as the token's user.
+func (c *Claims) IsImpersonated() bool {
+	return c.Act != nil
+}
+
+// IsAdmin reports whether the token belongs to an ADMIN user.
+func (c *Claims) IsAdmin() bool {
+	return c.UserType == "ADMIN"
+}
+
+// HasScope reports whether the token grants scope. Tokens without scopes come from an
+// interactive login and grant everything.
+func (c *Claims) HasScope(scope string) bool {
+	if len(c.Scopes) == 0 {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticatedWithin reports whether the user proved who they are within maxAge and, when
+// methods are given, used one of them to do so. Services guard sensitive actions with it
+// the way the authentication service's RequireRecentAuth middleware does.
+func (c *Claims) AuthenticatedWithin(maxAge time.Duration, methods ...string) bool {
+	if c.AuthTime == 0 || time.Since(time.Unix(c.AuthTime, 0)) > maxAge {
+		return false
+	}
+	if len(methods) == 0 {
+		return true
+	}
+	for _, used := range c.AMR {
+		for _, method := range methods {
+			if used == method {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims stored by one of the middleware adapters.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
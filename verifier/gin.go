@@ -0,0 +1,35 @@
+package verifier
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ginClaimsKey = "verifier.claims"
+
+// Gin returns gin middleware that rejects requests without a valid access token.
+// Handlers read the identity with GinClaims instead of c.GetString("uid").
+func (v *Verifier) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := v.Verify(TokenFromHeader(c.GetHeader("Authorization")))
+		if err != nil {
+			c.Header("WWW-Authenticate", challenge(err))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Set(ginClaimsKey, claims)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+// GinClaims returns the claims stored by the Gin middleware.
+func GinClaims(c *gin.Context) (*Claims, bool) {
+	claims, ok := c.Get(ginClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	typed, ok := claims.(*Claims)
+	return typed, ok
+}
@@ -0,0 +1,97 @@
+package verifier
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// keySet caches the RSA keys published at a JWKS URL.
+type keySet struct {
+	url        string
+	client     *http.Client
+	minRefetch time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*rsa.PublicKey
+	lastFetched time.Time
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// refresh downloads the key set and replaces the cached keys.
+func (ks *keySet) refresh() error {
+	resp, err := ks.client.Get(ks.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("verifier: fetching JWKS returned %s", resp.Status)
+	}
+
+	var body struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("verifier: decoding JWKS: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range body.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(key.N)
+		e, errE := base64.RawURLEncoding.DecodeString(key.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.lastFetched = time.Now()
+	ks.mu.Unlock()
+	return nil
+}
+
+// key returns the public key for kid. An unknown kid causes a refetch, at most once per
+// minRefetch, so a freshly rotated key is picked up without waiting for the next refresh.
+func (ks *keySet) key(kid string) (*rsa.PublicKey, error) {
+	ks.mu.RLock()
+	key, found := ks.keys[kid]
+	lastFetched := ks.lastFetched
+	ks.mu.RUnlock()
+	if found {
+		return key, nil
+	}
+
+	if time.Since(lastFetched) < ks.minRefetch {
+		return nil, errors.New("verifier: unknown signing key")
+	}
+	if err := ks.refresh(); err != nil {
+		return nil, err
+	}
+
+	ks.mu.RLock()
+	key, found = ks.keys[kid]
+	ks.mu.RUnlock()
+	if !found {
+		return nil, errors.New("verifier: unknown signing key")
+	}
+	return key, nil
+}
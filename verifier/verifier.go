@@ -0,0 +1,133 @@
+// Package verifier checks access tokens issued by the authentication service in other Go
+// services. It fetches the service's public keys from its JWKS endpoint, keeps them fresh
+// in the background and has no database dependency.
+//
+// Verification is offline: a token stays valid until it expires even if its session was
+// signed out. Services that need revocation checks should use the introspection endpoint.
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	// ErrNoToken is returned when the request carries no bearer token.
+	ErrNoToken = errors.New("verifier: no bearer token")
+	// ErrInvalidToken is returned for tokens that are malformed, expired or badly signed.
+	ErrInvalidToken = errors.New("verifier: invalid token")
+)
+
+// Config configures a Verifier.
+type Config struct {
+	// JWKSURL is the authentication service's key set, e.g. https://auth.example.com/.well-known/jwks.json.
+	JWKSURL string
+	// Issuer, when set, must match the token's iss claim.
+	Issuer string
+	// RefreshInterval is how often keys are refetched in the background. Defaults to 5 minutes.
+	RefreshInterval time.Duration
+	// HTTPClient is used to fetch keys. Defaults to a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// Verifier validates access tokens against the published signing keys.
+type Verifier struct {
+	config Config
+	keys   *keySet
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// New fetches the key set once and starts refreshing it in the background.
+// Call Close to stop the refresh goroutine.
+func New(config Config) (*Verifier, error) {
+	if config.JWKSURL == "" {
+		return nil, errors.New("verifier: JWKSURL is required")
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 5 * time.Minute
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	v := &Verifier{
+		config: config,
+		keys:   &keySet{url: config.JWKSURL, client: config.HTTPClient, minRefetch: 30 * time.Second},
+		stop:   make(chan struct{}),
+	}
+	if err := v.keys.refresh(); err != nil {
+		return nil, err
+	}
+
+	go v.refreshLoop()
+	return v, nil
+}
+
+func (v *Verifier) refreshLoop() {
+	ticker := time.NewTicker(v.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// Keep the old keys on failure; they remain valid until the next success
+			v.keys.refresh()
+		case <-v.stop:
+			return
+		}
+	}
+}
+
+// Close stops the background key refresh.
+func (v *Verifier) Close() {
+	v.once.Do(func() { close(v.stop) })
+}
+
+// Verify checks the signature, expiry, issuer and type of an access token and returns its claims.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrNoToken
+	}
+
+	claims := &Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.key(kid)
+	})
+	if err != nil || !parsed.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.TokenType != "access" {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+	if v.config.Issuer != "" && !claims.VerifyIssuer(v.config.Issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// TokenFromHeader extracts the token from an "Authorization: Bearer" header value.
+func TokenFromHeader(authorization string) string {
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+// challenge is the RFC 6750 WWW-Authenticate value for a failed verification.
+func challenge(err error) string {
+	if errors.Is(err, ErrNoToken) {
+		return `Bearer`
+	}
+	return `Bearer error="invalid_token"`
+}